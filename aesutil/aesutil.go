@@ -7,10 +7,18 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"errors"
+	"fmt"
 	"io"
+	"strings"
 )
 
+// prefixGCM is prepended to the base64 output of EncryptGCM. The "." isn't in
+// the base64 alphabet, so it can't be confused with the output of Encrypt.
+const prefixGCM = "g1."
+
 // Encrypt binary data to a base64 string with AES using the key provided.
+//
+// The ciphertext is not authenticated; new code should use EncryptGCM.
 func Encrypt(keyString string, data []byte) (string, error) {
 	key := []byte(keyString)
 
@@ -32,17 +40,36 @@ func Encrypt(keyString string, data []byte) (string, error) {
 }
 
 // Decrypt a base64 string to binary data with AES using the key provided.
+//
+// This accepts both the output of Encrypt and EncryptGCM (without additional
+// data); the output of EncryptGCM is authenticated. Use DecryptGCM if the
+// ciphertext must be authenticated.
 func Decrypt(keyString string, base64Data string) ([]byte, error) {
-	key := []byte(keyString)
-	ciphertext, err := base64.URLEncoding.DecodeString(base64Data)
+	block, err := aes.NewCipher([]byte(keyString))
 	if err != nil {
 		return nil, err
 	}
+	return decryptLegacy(block, base64Data, nil)
+}
 
-	block, err := aes.NewCipher(key)
+// decryptLegacy decrypts the output of Encrypt or EncryptGCM.
+func decryptLegacy(block cipher.Block, base64Data string, additionalData []byte) ([]byte, error) {
+	if data, ok := strings.CutPrefix(base64Data, prefixGCM); ok {
+		ciphertext, err := base64.URLEncoding.DecodeString(data)
+		if err != nil {
+			return nil, err
+		}
+		return openGCM(block, ciphertext, additionalData)
+	}
+
+	ciphertext, err := base64.URLEncoding.DecodeString(base64Data)
 	if err != nil {
 		return nil, err
 	}
+	// CFB doesn't support additional data.
+	if additionalData != nil {
+		return nil, errors.New("additional data given for ciphertext created with Encrypt")
+	}
 
 	if len(ciphertext) < aes.BlockSize {
 		return nil, errors.New("ciphertext provided is smaller than AES block size")
@@ -56,3 +83,87 @@ func Decrypt(keyString string, base64Data string) ([]byte, error) {
 
 	return ciphertext, nil
 }
+
+// EncryptGCM encrypts binary data to a base64 string with AES-GCM using the key
+// provided.
+//
+// The ciphertext is authenticated: DecryptGCM will return an error if it was
+// modified. The additionalData is authenticated but not encrypted or stored,
+// and must be passed to DecryptGCM again; it can be nil.
+//
+// The output is "g1." followed by the base64 encoded nonce, encrypted data, and
+// GCM tag.
+func EncryptGCM(keyString string, data, additionalData []byte) (string, error) {
+	block, err := aes.NewCipher([]byte(keyString))
+	if err != nil {
+		return "", err
+	}
+
+	ciphertext, err := sealGCM(block, nil, data, additionalData)
+	if err != nil {
+		return "", err
+	}
+	return prefixGCM + base64.URLEncoding.EncodeToString(ciphertext), nil
+}
+
+// DecryptGCM decrypts a base64 string created with EncryptGCM using the key
+// and additionalData provided.
+//
+// Unlike Decrypt, this does not accept the output of Encrypt.
+func DecryptGCM(keyString string, base64Data string, additionalData []byte) ([]byte, error) {
+	block, err := aes.NewCipher([]byte(keyString))
+	if err != nil {
+		return nil, err
+	}
+
+	data, ok := strings.CutPrefix(base64Data, prefixGCM)
+	if !ok {
+		return nil, errors.New("ciphertext provided was not created with EncryptGCM")
+	}
+	ciphertext, err := base64.URLEncoding.DecodeString(data)
+	if err != nil {
+		return nil, err
+	}
+	return openGCM(block, ciphertext, additionalData)
+}
+
+// sealGCM encrypts data with GCM, and returns it as the header followed by the
+// nonce and sealed data.
+func sealGCM(block cipher.Block, header, data, additionalData []byte) ([]byte, error) {
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, len(header)+gcm.NonceSize(), len(header)+gcm.NonceSize()+len(data)+gcm.Overhead())
+	copy(out, header)
+	nonce := out[len(header):]
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(out, nonce, data, additionalData), nil
+}
+
+// openGCM decrypts the nonce and sealed data created with sealGCM; the header
+// must already be removed.
+func openGCM(block cipher.Block, ciphertext, additionalData []byte) ([]byte, error) {
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) < gcm.NonceSize()+gcm.Overhead() {
+		return nil, errors.New("ciphertext provided is too short")
+	}
+
+	nonce := ciphertext[:gcm.NonceSize()]
+	return gcm.Open(nil, nonce, ciphertext[gcm.NonceSize():], additionalData)
+}
+
+func errUnsupportedVersion(ciphertext []byte) error {
+	if len(ciphertext) == 0 {
+		return errors.New("ciphertext provided is empty")
+	}
+	return fmt.Errorf("unsupported ciphertext version %#x", ciphertext[0])
+}
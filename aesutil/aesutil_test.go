@@ -1,9 +1,12 @@
 package aesutil
 
 import (
+	"encoding/base64"
 	"fmt"
+	"strings"
 	"testing"
 
+	"github.com/teamwork/test"
 	"github.com/teamwork/test/diff"
 )
 
@@ -92,3 +95,117 @@ func TestEncryptAndDecrypt(t *testing.T) {
 		})
 	}
 }
+
+func TestEncryptGCM(t *testing.T) {
+	tests := []struct {
+		data, ad string
+	}{
+		{testPlaintext, ""},
+		{"I love jam", "user:42"},
+		{"", ""},
+		{"", "only additional data"},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test-%v", i), func(t *testing.T) {
+			var ad []byte
+			if tt.ad != "" {
+				ad = []byte(tt.ad)
+			}
+
+			cipher, err := EncryptGCM(testKeyString, []byte(tt.data), ad)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			plain, err := DecryptGCM(testKeyString, cipher, ad)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(plain) != tt.data {
+				t.Fatal(diff.Cmp(tt.data, string(plain)))
+			}
+
+			if ad == nil {
+				plain, err = Decrypt(testKeyString, cipher)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(plain) != tt.data {
+					t.Fatal(diff.Cmp(tt.data, string(plain)))
+				}
+			}
+
+			if _, err := DecryptGCM(testKeyString, cipher, []byte("wrong")); err == nil {
+				t.Error("DecryptGCM succeeded with wrong additional data")
+			}
+			if _, err := DecryptGCM("aaaaffff12345678", cipher, ad); err == nil {
+				t.Error("DecryptGCM succeeded with an incorrect key")
+			}
+		})
+	}
+}
+
+func TestDecryptGCMInvalid(t *testing.T) {
+	cipher, err := EncryptGCM(testKeyString, []byte(testPlaintext), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Flip a bit in the encrypted data.
+	tampered := tamperGCM(cipher, 20)
+	if _, err := DecryptGCM(testKeyString, tampered, nil); err == nil {
+		t.Error("DecryptGCM succeeded with tampered ciphertext")
+	}
+	if _, err := Decrypt(testKeyString, tampered); !test.ErrorContains(err, "message authentication failed") {
+		t.Errorf("wrong error from Decrypt for tampered ciphertext: %v", err)
+	}
+
+	// Legacy CFB ciphertext is not accepted.
+	if _, err := DecryptGCM(testKeyString, testCiphertext, nil); err == nil {
+		t.Error("DecryptGCM succeeded with CFB ciphertext")
+	}
+
+	// Too short.
+	if _, err := DecryptGCM(testKeyString, "g1.AQID", nil); err == nil {
+		t.Error("DecryptGCM succeeded with short ciphertext")
+	}
+
+	if _, err := DecryptGCM("", cipher, nil); err == nil {
+		t.Error("DecryptGCM succeeded with an empty key")
+	}
+}
+
+// tamperGCM flips a bit in the byte n bytes from the end of an EncryptGCM
+// ciphertext.
+func tamperGCM(cipher string, n int) string {
+	raw, _ := base64.URLEncoding.DecodeString(strings.TrimPrefix(cipher, prefixGCM))
+	raw[len(raw)-n] ^= 0x01
+	return prefixGCM + base64.URLEncoding.EncodeToString(raw)
+}
+
+func TestDecryptCFBWithVersionByte(t *testing.T) {
+	// The IV is random, so about 1 in 256 CFB ciphertexts start with the byte
+	// that was used as the GCM version before the "g1." prefix; make sure these
+	// still decrypt.
+	for i := 0; i < 10000; i++ {
+		cipher, err := Encrypt(testKeyString, []byte(testPlaintext))
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw, _ := base64.URLEncoding.DecodeString(cipher)
+		if raw[0] != 0x01 {
+			continue
+		}
+
+		plain, err := Decrypt(testKeyString, cipher)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(plain) != testPlaintext {
+			t.Fatal(diff.Cmp(testPlaintext, string(plain)))
+		}
+		return
+	}
+	t.Skip("no CFB ciphertext starting with the version byte")
+}
@@ -0,0 +1,182 @@
+package aesutil
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// prefixKeyring is prepended to the base64 output of Keyring.Encrypt, so it
+// can't be confused with the output of Encrypt or EncryptGCM.
+const prefixKeyring = "k1."
+
+// Keyring holds multiple keys identified by a key ID, so that keys can be
+// rotated without re-encrypting all data at once.
+//
+// Data is always encrypted with the primary key, and the key ID is stored in
+// the ciphertext so it can be decrypted with the correct key later on.
+//
+// A Keyring is safe for concurrent use.
+type Keyring struct {
+	primary string
+	legacy  string
+	keys    map[string]cipher.Block
+}
+
+// KeyringOption is a function that configures a Keyring.
+type KeyringOption func(*Keyring)
+
+// KeyringWithLegacyKey sets the ID of the key used to decrypt data that doesn't
+// store a key ID, i.e. data created with Encrypt or EncryptGCM. By default such
+// data can't be decrypted.
+func KeyringWithLegacyKey(id string) KeyringOption {
+	return func(k *Keyring) {
+		k.legacy = id
+	}
+}
+
+// NewKeyring creates a new keyring from a map of key IDs to keys; primary is the
+// ID of the key used for encryption.
+//
+// Key IDs must be between 1 and 255 bytes, and keys must be valid AES keys.
+func NewKeyring(primary string, keys map[string]string, options ...KeyringOption) (*Keyring, error) {
+	k := &Keyring{
+		primary: primary,
+		keys:    make(map[string]cipher.Block, len(keys)),
+	}
+	for _, option := range options {
+		option(k)
+	}
+
+	for id, key := range keys {
+		if id == "" || len(id) > 255 {
+			return nil, fmt.Errorf("invalid key ID %q: must be between 1 and 255 bytes", id)
+		}
+		block, err := aes.NewCipher([]byte(key))
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", id, err)
+		}
+		k.keys[id] = block
+	}
+
+	if _, ok := k.keys[primary]; !ok {
+		return nil, fmt.Errorf("primary key %q is not in the keyring", primary)
+	}
+	if _, ok := k.keys[k.legacy]; k.legacy != "" && !ok {
+		return nil, fmt.Errorf("legacy key %q is not in the keyring", k.legacy)
+	}
+	return k, nil
+}
+
+// Primary gets the ID of the primary key.
+func (k *Keyring) Primary() string { return k.primary }
+
+// Encrypt binary data to a base64 string with AES-GCM using the primary key.
+//
+// The additionalData is authenticated but not stored, and must be passed to
+// Decrypt again; it can be nil.
+func (k *Keyring) Encrypt(data, additionalData []byte) (string, error) {
+	header := make([]byte, 0, 1+len(k.primary))
+	header = append(header, byte(len(k.primary)))
+	header = append(header, k.primary...)
+
+	ciphertext, err := sealGCM(k.keys[k.primary], header, data, additionalData)
+	if err != nil {
+		return "", err
+	}
+	return prefixKeyring + base64.URLEncoding.EncodeToString(ciphertext), nil
+}
+
+// Decrypt a base64 string created with Encrypt, using the key that the
+// ciphertext names.
+//
+// If a legacy key is set this also decrypts data created with Encrypt or
+// EncryptGCM; see the Decrypt function for the caveats.
+func (k *Keyring) Decrypt(base64Data string, additionalData []byte) ([]byte, error) {
+	plain, _, err := k.decrypt(base64Data, additionalData)
+	return plain, err
+}
+
+// Reencrypt decrypts base64Data and encrypts it again with the primary key.
+//
+// The ciphertext is returned as-is if it's already encrypted with the primary
+// key; the returned bool indicates if it was changed. This allows migrating
+// data lazily, for example when it's read:
+//
+//	val, changed, err := keyring.Reencrypt(row.Secret, nil)
+//	if changed {
+//	    // Store val
+//	}
+func (k *Keyring) Reencrypt(base64Data string, additionalData []byte) (string, bool, error) {
+	plain, id, err := k.decrypt(base64Data, additionalData)
+	if err != nil {
+		return "", false, err
+	}
+	if id == k.primary {
+		return base64Data, false, nil
+	}
+
+	ciphertext, err := k.Encrypt(plain, additionalData)
+	if err != nil {
+		return "", false, err
+	}
+	return ciphertext, true, nil
+}
+
+// decrypt base64Data, returning the ID of the key that was used. The ID is empty
+// if it was decrypted with the legacy key.
+func (k *Keyring) decrypt(base64Data string, additionalData []byte) ([]byte, string, error) {
+	data, ok := strings.CutPrefix(base64Data, prefixKeyring)
+	if !ok {
+		if k.legacy == "" {
+			return nil, "", errors.New("ciphertext provided was not created with a Keyring")
+		}
+		plain, err := decryptLegacy(k.keys[k.legacy], base64Data, additionalData)
+		return plain, "", err
+	}
+
+	ciphertext, err := base64.URLEncoding.DecodeString(data)
+	if err != nil {
+		return nil, "", err
+	}
+	id, body, err := parseKeyID(ciphertext)
+	if err != nil {
+		return nil, "", err
+	}
+	block, ok := k.keys[id]
+	if !ok {
+		return nil, "", fmt.Errorf("unknown key ID %q", id)
+	}
+	plain, err := openGCM(block, body, additionalData)
+	return plain, id, err
+}
+
+// parseKeyID parses the key ID and the remaining nonce and sealed data from the
+// ciphertext.
+func parseKeyID(ciphertext []byte) (string, []byte, error) {
+	if len(ciphertext) < 1 || len(ciphertext) < 1+int(ciphertext[0]) {
+		return "", nil, errors.New("ciphertext provided is too short")
+	}
+
+	idLen := int(ciphertext[0])
+	if idLen == 0 {
+		return "", nil, errors.New("ciphertext provided has an empty key ID")
+	}
+	return string(ciphertext[1 : 1+idLen]), ciphertext[1+idLen:], nil
+}
+
+// KeyProvider encrypts and decrypts data with keys it manages, such as a
+// Keyring.
+type KeyProvider interface {
+	// Encrypt binary data to a base64 string; the additionalData is
+	// authenticated but not stored.
+	Encrypt(data, additionalData []byte) (string, error)
+
+	// Decrypt a base64 string created with Encrypt.
+	Decrypt(base64Data string, additionalData []byte) ([]byte, error)
+}
+
+var _ KeyProvider = &Keyring{}
@@ -0,0 +1,212 @@
+package aesutil
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/teamwork/test"
+	"github.com/teamwork/test/diff"
+)
+
+func TestNewKeyring(t *testing.T) {
+	tests := []struct {
+		primary string
+		keys    map[string]string
+		options []KeyringOption
+		wantErr string
+	}{
+		{"a", map[string]string{"a": testKeyString}, nil, ""},
+		{"b", map[string]string{"a": testKeyString}, nil, `primary key "b" is not in the keyring`},
+		{"a", map[string]string{"a": "short"}, nil, `key "a": crypto/aes: invalid key size 5`},
+		{"", map[string]string{"": testKeyString}, nil, `invalid key ID ""`},
+		{"a", map[string]string{"a": testKeyString}, []KeyringOption{KeyringWithLegacyKey("x")},
+			`legacy key "x" is not in the keyring`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.wantErr, func(t *testing.T) {
+			_, err := NewKeyring(tt.primary, tt.keys, tt.options...)
+			if !test.ErrorContains(err, tt.wantErr) {
+				t.Errorf("\nout:  %v\nwant: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestKeyring(t *testing.T) {
+	keys := map[string]string{
+		"2024": testKeyString,
+		"2025": "0123456789abcdef0123456789abcdef",
+	}
+	old, err := NewKeyring("2024", keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cur, err := NewKeyring("2025", keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldCipher, err := old.Encrypt([]byte(testPlaintext), []byte("ad"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Encrypted with the old primary key, but still readable.
+	plain, err := cur.Decrypt(oldCipher, []byte("ad"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plain) != testPlaintext {
+		t.Fatal(diff.Cmp(testPlaintext, string(plain)))
+	}
+	if _, err := cur.Decrypt(oldCipher, nil); err == nil {
+		t.Error("Decrypt succeeded without additional data")
+	}
+
+	newCipher, changed, err := cur.Reencrypt(oldCipher, []byte("ad"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed || newCipher == oldCipher {
+		t.Fatal("Reencrypt didn't change the ciphertext")
+	}
+
+	again, changed, err := cur.Reencrypt(newCipher, []byte("ad"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed || again != newCipher {
+		t.Fatal("Reencrypt changed ciphertext already using the primary key")
+	}
+
+	// Key removed from the keyring.
+	only, err := NewKeyring("2024", map[string]string{"2024": testKeyString})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := only.Decrypt(newCipher, []byte("ad")); !test.ErrorContains(err, `unknown key ID "2025"`) {
+		t.Errorf("wrong error: %v", err)
+	}
+}
+
+func TestKeyringLegacy(t *testing.T) {
+	keys := map[string]string{"old": testKeyString, "new": "0123456789abcdef"}
+
+	k, err := NewKeyring("new", keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := k.Decrypt(testCiphertext, nil); err == nil {
+		t.Fatal("Decrypt succeeded with legacy ciphertext without legacy key")
+	}
+
+	k, err = NewKeyring("new", keys, KeyringWithLegacyKey("old"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gcm, err := EncryptGCM(testKeyString, []byte(testPlaintext), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []string{testCiphertext, gcm} {
+		plain, err := k.Decrypt(c, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(plain) != testPlaintext {
+			t.Fatal(diff.Cmp(testPlaintext, string(plain)))
+		}
+
+		newCipher, changed, err := k.Reencrypt(c, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !changed {
+			t.Fatal("legacy ciphertext not changed")
+		}
+		plain, err = k.Decrypt(newCipher, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(plain) != testPlaintext {
+			t.Fatal(diff.Cmp(testPlaintext, string(plain)))
+		}
+	}
+}
+
+func TestKeyringLegacyTampered(t *testing.T) {
+	keys := map[string]string{"old": testKeyString, "new": "0123456789abcdef"}
+	k, err := NewKeyring("new", keys, KeyringWithLegacyKey("old"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("tampered", func(t *testing.T) {
+		c, err := k.Encrypt([]byte(testPlaintext), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := base64.URLEncoding.DecodeString(strings.TrimPrefix(c, prefixKeyring))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b[len(b)-1] ^= 0xff
+		c = prefixKeyring + base64.URLEncoding.EncodeToString(b)
+
+		if _, err := k.Decrypt(c, nil); !test.ErrorContains(err, "message authentication failed") {
+			t.Errorf("wrong error: %v", err)
+		}
+		if _, changed, err := k.Reencrypt(c, nil); err == nil || changed {
+			t.Errorf("Reencrypt succeeded for tampered data: changed=%v", changed)
+		}
+	})
+
+	t.Run("unknown key ID", func(t *testing.T) {
+		other, err := NewKeyring("other", map[string]string{"other": testKeyString})
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := other.Encrypt([]byte(testPlaintext), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := k.Decrypt(c, nil); !test.ErrorContains(err, `unknown key ID "other"`) {
+			t.Errorf("wrong error: %v", err)
+		}
+	})
+}
+
+// Legacy CFB ciphertexts start with a random IV, which may look like the old
+// keyring header.
+func TestKeyringLegacyVersionByte(t *testing.T) {
+	keys := map[string]string{"old": testKeyString, "new": "0123456789abcdef"}
+	k, err := NewKeyring("new", keys, KeyringWithLegacyKey("old"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10; {
+		c, err := Encrypt(testKeyString, []byte(testPlaintext))
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw, _ := base64.URLEncoding.DecodeString(c)
+		if raw[0] != 0x02 {
+			continue
+		}
+		i++
+
+		out, err := k.Decrypt(c, nil)
+		if err != nil {
+			t.Fatalf("Decrypt(%q): %v", c, err)
+		}
+		if string(out) != testPlaintext {
+			t.Errorf("Decrypt(%q) = %q", c, out)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package aesutil
+
+import (
+	"crypto/aes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	versionPassphrase byte = 0x04
+
+	kdfSaltSize   = 16
+	kdfKeySize    = 32
+	kdfParamsSize = 4 + 4 + 1
+	kdfHeaderSize = 1 + kdfParamsSize + kdfSaltSize
+	kdfMaxTime    = 100
+	kdfMaxMemory  = 1024 * 1024
+	kdfMinMemory  = 8
+)
+
+// KDFParams are the cost parameters for deriving a key from a passphrase with
+// argon2id.
+type KDFParams struct {
+	Time    uint32 // Number of passes over the memory.
+	Memory  uint32 // Memory to use in KiB; at most 1GiB.
+	Threads uint8  // Number of threads; at least 1.
+}
+
+// DefaultKDFParams are the default cost parameters; this is the second
+// recommended option from RFC 9106 (3 passes, 64MiB, 4 threads).
+//
+// These may be increased in future versions. Existing data will remain
+// readable as the parameters are stored in the ciphertext.
+var DefaultKDFParams = KDFParams{
+	Time:    3,
+	Memory:  64 * 1024,
+	Threads: 4,
+}
+
+func (p KDFParams) validate() error {
+	switch {
+	case p.Time < 1 || p.Time > kdfMaxTime:
+		return fmt.Errorf("invalid KDF time %d: must be between 1 and %d", p.Time, kdfMaxTime)
+	case p.Memory < kdfMinMemory || p.Memory > kdfMaxMemory:
+		return fmt.Errorf("invalid KDF memory %d: must be between %d and %d KiB", p.Memory, kdfMinMemory, kdfMaxMemory)
+	case p.Threads < 1:
+		return errors.New("invalid KDF threads 0: must be at least 1")
+	}
+	return nil
+}
+
+// DeriveKey derives a 32-byte key from a passphrase with argon2id, suitable for
+// use with Encrypt, EncryptGCM, or a Keyring.
+//
+// The salt should be random, and must be stored along with the data to derive
+// the same key again.
+func DeriveKey(passphrase string, salt []byte, params KDFParams) (string, error) {
+	if err := params.validate(); err != nil {
+		return "", err
+	}
+	return string(argon2.IDKey([]byte(passphrase), salt, params.Time, params.Memory, params.Threads, kdfKeySize)), nil
+}
+
+// EncryptPassphrase encrypts binary data to a base64 string with AES-GCM using a
+// key derived from the passphrase.
+//
+// A random salt and the cost parameters are stored in the ciphertext, so only
+// the passphrase is needed to decrypt it. The additionalData is authenticated
+// but not stored, and must be passed to DecryptPassphrase again; it can be nil.
+//
+// Deriving the key is deliberately slow, so this is not suitable for
+// encrypting many small values; use DeriveKey and EncryptGCM for that.
+func EncryptPassphrase(passphrase string, params KDFParams, data, additionalData []byte) (string, error) {
+	header := make([]byte, kdfHeaderSize)
+	header[0] = versionPassphrase
+	binary.BigEndian.PutUint32(header[1:], params.Time)
+	binary.BigEndian.PutUint32(header[5:], params.Memory)
+	header[9] = params.Threads
+	salt := header[1+kdfParamsSize:]
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return "", err
+	}
+
+	key, err := DeriveKey(passphrase, salt, params)
+	if err != nil {
+		return "", err
+	}
+	block, err := aes.NewCipher([]byte(key))
+	if err != nil {
+		return "", err
+	}
+
+	ciphertext, err := sealGCM(block, header, data, additionalData)
+	if err != nil {
+		return "", err
+	}
+	return base64.URLEncoding.EncodeToString(ciphertext), nil
+}
+
+// DecryptPassphrase decrypts a base64 string created with EncryptPassphrase.
+func DecryptPassphrase(passphrase, base64Data string, additionalData []byte) ([]byte, error) {
+	ciphertext, err := base64.URLEncoding.DecodeString(base64Data)
+	if err != nil {
+		return nil, err
+	}
+
+	params, err := parseKDFParams(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := DeriveKey(passphrase, ciphertext[1+kdfParamsSize:kdfHeaderSize], params)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher([]byte(key))
+	if err != nil {
+		return nil, err
+	}
+
+	return openGCM(block, ciphertext[kdfHeaderSize:], additionalData)
+}
+
+// PassphraseParams gets the cost parameters that were used to encrypt a base64
+// string created with EncryptPassphrase.
+//
+// This can be used to re-encrypt data when the parameters are increased:
+//
+//	if p, _ := aesutil.PassphraseParams(data); p != aesutil.DefaultKDFParams {
+//	    // Decrypt and encrypt again.
+//	}
+func PassphraseParams(base64Data string) (KDFParams, error) {
+	ciphertext, err := base64.URLEncoding.DecodeString(base64Data)
+	if err != nil {
+		return KDFParams{}, err
+	}
+	return parseKDFParams(ciphertext)
+}
+
+func parseKDFParams(ciphertext []byte) (KDFParams, error) {
+	if len(ciphertext) == 0 || ciphertext[0] != versionPassphrase {
+		return KDFParams{}, errUnsupportedVersion(ciphertext)
+	}
+	if len(ciphertext) < kdfHeaderSize {
+		return KDFParams{}, errors.New("ciphertext provided is too short")
+	}
+
+	params := KDFParams{
+		Time:    binary.BigEndian.Uint32(ciphertext[1:]),
+		Memory:  binary.BigEndian.Uint32(ciphertext[5:]),
+		Threads: ciphertext[9],
+	}
+	// Validate here too, so that a modified ciphertext can't make us use an
+	// excessive amount of memory.
+	return params, params.validate()
+}
@@ -0,0 +1,113 @@
+package aesutil
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/teamwork/test"
+	"github.com/teamwork/test/diff"
+)
+
+// Cheap parameters to keep the tests fast.
+var testKDFParams = KDFParams{Time: 1, Memory: 64, Threads: 1}
+
+func TestPassphrase(t *testing.T) {
+	for _, passphrase := range []string{"correct horse battery staple", "x", ""} {
+		t.Run(passphrase, func(t *testing.T) {
+			cipher, err := EncryptPassphrase(passphrase, testKDFParams, []byte(testPlaintext), []byte("ad"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			plain, err := DecryptPassphrase(passphrase, cipher, []byte("ad"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(plain) != testPlaintext {
+				t.Fatal(diff.Cmp(testPlaintext, string(plain)))
+			}
+
+			if _, err := DecryptPassphrase(passphrase+"!", cipher, []byte("ad")); err == nil {
+				t.Error("DecryptPassphrase succeeded with wrong passphrase")
+			}
+			if _, err := DecryptPassphrase(passphrase, cipher, nil); err == nil {
+				t.Error("DecryptPassphrase succeeded without additional data")
+			}
+
+			params, err := PassphraseParams(cipher)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if params != testKDFParams {
+				t.Errorf("\nout:  %#v\nwant: %#v", params, testKDFParams)
+			}
+		})
+	}
+}
+
+func TestPassphraseInvalid(t *testing.T) {
+	tests := []struct {
+		params  KDFParams
+		wantErr string
+	}{
+		{KDFParams{Time: 0, Memory: 64, Threads: 1}, "invalid KDF time 0"},
+		{KDFParams{Time: 1, Memory: 1, Threads: 1}, "invalid KDF memory 1"},
+		{KDFParams{Time: 1, Memory: 2 * 1024 * 1024, Threads: 1}, "invalid KDF memory 2097152"},
+		{KDFParams{Time: 1, Memory: 64, Threads: 0}, "invalid KDF threads 0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.wantErr, func(t *testing.T) {
+			_, err := EncryptPassphrase("x", tt.params, []byte(testPlaintext), nil)
+			if !test.ErrorContains(err, tt.wantErr) {
+				t.Errorf("\nout:  %v\nwant: %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	// Parameters in the ciphertext are validated too.
+	cipher, err := EncryptPassphrase("x", testKDFParams, []byte(testPlaintext), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := base64.URLEncoding.DecodeString(cipher)
+	raw[5] = 0xff
+	_, err = DecryptPassphrase("x", base64.URLEncoding.EncodeToString(raw), nil)
+	if !test.ErrorContains(err, "invalid KDF memory") {
+		t.Errorf("wrong error: %v", err)
+	}
+
+	if _, err := DecryptPassphrase("x", testCiphertext, nil); err == nil {
+		t.Error("DecryptPassphrase succeeded with CFB ciphertext")
+	}
+}
+
+func TestDeriveKey(t *testing.T) {
+	salt := []byte("0123456789abcdef")
+	key, err := DeriveKey("passphrase", salt, testKDFParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(key) != 32 {
+		t.Fatalf("wrong key length %d", len(key))
+	}
+
+	again, err := DeriveKey("passphrase", salt, testKDFParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != again {
+		t.Fatal("DeriveKey is not deterministic")
+	}
+
+	cipher, err := EncryptGCM(key, []byte(testPlaintext), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := DecryptGCM(key, cipher, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plain) != testPlaintext {
+		t.Fatal(diff.Cmp(testPlaintext, string(plain)))
+	}
+}
@@ -0,0 +1,179 @@
+package aesutil
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+const versionSIV byte = 0x05
+
+// EncryptSIV encrypts binary data to a base64 string with AES-SIV (RFC 5297)
+// using the key provided.
+//
+// Unlike the other functions in this package this is deterministic: the same
+// data, additionalData, and key always result in the same ciphertext. This
+// makes it possible to look up encrypted values with an equality check, but
+// also reveals which values are identical. Use EncryptGCM if that's not
+// required.
+//
+// The key must be 32, 48, or 64 bytes; the first half is used for
+// authentication and the second half for encryption. The additionalData is
+// authenticated but not stored, and must be passed to DecryptSIV again; it can
+// be nil.
+func EncryptSIV(keyString string, data, additionalData []byte) (string, error) {
+	mac, ctr, err := newSIV(keyString)
+	if err != nil {
+		return "", err
+	}
+
+	v := s2v(mac, additionalData, data)
+	out := make([]byte, 1+aes.BlockSize+len(data))
+	out[0] = versionSIV
+	copy(out[1:], v)
+	sivCTR(ctr, v).XORKeyStream(out[1+aes.BlockSize:], data)
+
+	return base64.URLEncoding.EncodeToString(out), nil
+}
+
+// DecryptSIV decrypts a base64 string created with EncryptSIV using the key and
+// additionalData provided.
+func DecryptSIV(keyString, base64Data string, additionalData []byte) ([]byte, error) {
+	ciphertext, err := base64.URLEncoding.DecodeString(base64Data)
+	if err != nil {
+		return nil, err
+	}
+
+	mac, ctr, err := newSIV(keyString)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) == 0 || ciphertext[0] != versionSIV {
+		return nil, errUnsupportedVersion(ciphertext)
+	}
+	if len(ciphertext) < 1+aes.BlockSize {
+		return nil, errors.New("ciphertext provided is too short")
+	}
+
+	v := ciphertext[1 : 1+aes.BlockSize]
+	plain := make([]byte, len(ciphertext)-1-aes.BlockSize)
+	sivCTR(ctr, v).XORKeyStream(plain, ciphertext[1+aes.BlockSize:])
+
+	if subtle.ConstantTimeCompare(s2v(mac, additionalData, plain), v) != 1 {
+		clear(plain)
+		return nil, errors.New("cipher: message authentication failed")
+	}
+	return plain, nil
+}
+
+// BlindIndex creates a keyed hash (HMAC-SHA256) of the data, as a base64
+// string.
+//
+// This can be stored alongside data encrypted with EncryptGCM to allow equality
+// lookups without storing the data deterministically encrypted. The key should
+// be different from the encryption key.
+func BlindIndex(keyString string, data []byte) string {
+	h := hmac.New(sha256.New, []byte(keyString))
+	h.Write(data)
+	return base64.URLEncoding.EncodeToString(h.Sum(nil))
+}
+
+// newSIV splits the key and creates the block ciphers for S2V and CTR.
+func newSIV(keyString string) (cipher.Block, cipher.Block, error) {
+	key := []byte(keyString)
+	switch len(key) {
+	case 32, 48, 64:
+	default:
+		return nil, nil, fmt.Errorf("invalid AES-SIV key size %d: must be 32, 48, or 64 bytes", len(key))
+	}
+
+	mac, err := aes.NewCipher(key[:len(key)/2])
+	if err != nil {
+		return nil, nil, err
+	}
+	ctr, err := aes.NewCipher(key[len(key)/2:])
+	if err != nil {
+		return nil, nil, err
+	}
+	return mac, ctr, nil
+}
+
+// sivCTR creates the CTR stream; the IV is the synthetic IV with the 31st and
+// 63rd bit (from the right) cleared.
+func sivCTR(block cipher.Block, v []byte) cipher.Stream {
+	iv := make([]byte, aes.BlockSize)
+	copy(iv, v)
+	iv[8] &= 0x7f
+	iv[12] &= 0x7f
+	return cipher.NewCTR(block, iv)
+}
+
+// s2v is the S2V construction from RFC 5297 section 2.4, with the additional
+// data as the only header.
+func s2v(block cipher.Block, additionalData, data []byte) []byte {
+	d := cmac(block, make([]byte, aes.BlockSize))
+	if len(additionalData) > 0 {
+		dbl(d)
+		subtle.XORBytes(d, d, cmac(block, additionalData))
+	}
+
+	var t []byte
+	if len(data) >= aes.BlockSize {
+		t = make([]byte, len(data))
+		copy(t, data)
+		subtle.XORBytes(t[len(t)-aes.BlockSize:], t[len(t)-aes.BlockSize:], d)
+	} else {
+		dbl(d)
+		t = make([]byte, aes.BlockSize)
+		copy(t, data)
+		t[len(data)] = 0x80
+		subtle.XORBytes(t, t, d)
+	}
+	return cmac(block, t)
+}
+
+// cmac is AES-CMAC from RFC 4493.
+func cmac(block cipher.Block, msg []byte) []byte {
+	k1 := make([]byte, aes.BlockSize)
+	block.Encrypt(k1, k1)
+	dbl(k1)
+
+	n := (len(msg) + aes.BlockSize - 1) / aes.BlockSize
+	last := make([]byte, aes.BlockSize)
+	if n > 0 && len(msg)%aes.BlockSize == 0 {
+		subtle.XORBytes(last, msg[(n-1)*aes.BlockSize:], k1)
+	} else {
+		k2 := k1
+		dbl(k2)
+		if n == 0 {
+			n = 1
+		}
+		copy(last, msg[(n-1)*aes.BlockSize:])
+		last[len(msg)%aes.BlockSize] = 0x80
+		subtle.XORBytes(last, last, k2)
+	}
+
+	x := make([]byte, aes.BlockSize)
+	for i := 0; i < n-1; i++ {
+		subtle.XORBytes(x, x, msg[i*aes.BlockSize:(i+1)*aes.BlockSize])
+		block.Encrypt(x, x)
+	}
+	subtle.XORBytes(x, x, last)
+	block.Encrypt(x, x)
+	return x
+}
+
+// dbl multiplies b by x in GF(2^128), in place.
+func dbl(b []byte) {
+	carry := b[0] >> 7
+	for i := 0; i < len(b)-1; i++ {
+		b[i] = b[i]<<1 | b[i+1]>>7
+	}
+	b[len(b)-1] = b[len(b)-1]<<1 ^ (carry * 0x87)
+}
@@ -0,0 +1,129 @@
+package aesutil
+
+import (
+	"crypto/aes"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/teamwork/test/diff"
+)
+
+const testSIVKey = "0123456789abcdef0123456789abcdef"
+
+func unhex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestCMAC(t *testing.T) {
+	// Test vectors from RFC 4493 section 4.
+	tests := []struct {
+		msg, want string
+	}{
+		{"", "bb1d6929 e9593728 7fa37d12 9b756746"},
+		{"6bc1bee2 2e409f96 e93d7e11 7393172a", "070a16b4 6b4d4144 f79bdd9d d04a287c"},
+		{"6bc1bee2 2e409f96 e93d7e11 7393172a ae2d8a57 1e03ac9c 9eb76fac 45af8e51 30c81c46 a35ce411",
+			"dfa66747 de9ae630 30ca3261 1497c827"},
+		{"6bc1bee2 2e409f96 e93d7e11 7393172a ae2d8a57 1e03ac9c 9eb76fac 45af8e51 " +
+			"30c81c46 a35ce411 e5fbc119 1a0a52ef f69f2445 df4f9b17 ad2b417b e66c3710",
+			"51f0bebf 7e3b9d92 fc497417 79363cfe"},
+	}
+
+	block, err := aes.NewCipher(unhex(t, "2b7e1516 28aed2a6 abf71588 09cf4f3c"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run("", func(t *testing.T) {
+			out := hex.EncodeToString(cmac(block, unhex(t, tt.msg)))
+			want := strings.ReplaceAll(tt.want, " ", "")
+			if out != want {
+				t.Errorf("\nout:  %s\nwant: %s", out, want)
+			}
+		})
+	}
+}
+
+func TestSIVVector(t *testing.T) {
+	// Test vector from RFC 5297 appendix A.1.
+	key := unhex(t, "fffefdfc fbfaf9f8 f7f6f5f4 f3f2f1f0 f0f1f2f3 f4f5f6f7 f8f9fafb fcfdfeff")
+	ad := unhex(t, "10111213 14151617 18191a1b 1c1d1e1f 20212223 24252627")
+	plain := unhex(t, "11223344 55667788 99aabbcc ddee")
+	want := "85632d07c6e8f37f950acd320a2ecc9340c02b9690c4dc04daef7f6afe5c"
+
+	cipher, err := EncryptSIV(string(key), plain, ad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := base64.URLEncoding.DecodeString(cipher)
+	if out := hex.EncodeToString(raw[1:]); out != want {
+		t.Errorf("\nout:  %s\nwant: %s", out, want)
+	}
+
+	out, err := DecryptSIV(string(key), cipher, ad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != string(plain) {
+		t.Error(diff.Cmp(string(plain), string(out)))
+	}
+}
+
+func TestSIV(t *testing.T) {
+	for _, data := range []string{"", "a", testPlaintext, "exactly16bytes!!", "jam@example.com and some more text"} {
+		t.Run(data, func(t *testing.T) {
+			c1, err := EncryptSIV(testSIVKey, []byte(data), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c2, err := EncryptSIV(testSIVKey, []byte(data), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c1 != c2 {
+				t.Errorf("not deterministic:\n%s\n%s", c1, c2)
+			}
+
+			plain, err := DecryptSIV(testSIVKey, c1, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(plain) != data {
+				t.Fatal(diff.Cmp(data, string(plain)))
+			}
+
+			if _, err := DecryptSIV(testSIVKey, c1, []byte("ad")); err == nil {
+				t.Error("DecryptSIV succeeded with wrong additional data")
+			}
+
+			raw, _ := base64.URLEncoding.DecodeString(c1)
+			raw[len(raw)-1] ^= 1
+			if _, err := DecryptSIV(testSIVKey, base64.URLEncoding.EncodeToString(raw), nil); err == nil {
+				t.Error("DecryptSIV succeeded with tampered ciphertext")
+			}
+		})
+	}
+
+	if _, err := EncryptSIV(testKeyString, nil, nil); err == nil {
+		t.Error("EncryptSIV succeeded with 16-byte key")
+	}
+}
+
+func TestBlindIndex(t *testing.T) {
+	a := BlindIndex("key", []byte("jam@example.com"))
+	if a != BlindIndex("key", []byte("jam@example.com")) {
+		t.Error("not deterministic")
+	}
+	if a == BlindIndex("other", []byte("jam@example.com")) {
+		t.Error("same index with different key")
+	}
+	if a == BlindIndex("key", []byte("jam@example.org")) {
+		t.Error("same index with different data")
+	}
+}
@@ -0,0 +1,264 @@
+package aesutil
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	versionStream byte = 0x03
+
+	// Size of the plaintext in every segment; the last segment may be
+	// smaller.
+	streamSegmentSize = 64 * 1024
+	streamSaltSize    = 16
+	streamTagSize     = 16
+	streamHeaderSize  = 1 + streamSaltSize
+	streamInfo        = "github.com/teamwork/utils/v2/aesutil stream"
+)
+
+// ErrStreamTruncated is returned when reading from a stream that ended before
+// the final segment.
+var ErrStreamTruncated = errors.New("encrypted stream is truncated")
+
+var errStreamClosed = errors.New("write to closed encrypt writer")
+
+// NewEncryptWriter returns a writer which encrypts everything written to it
+// with the key provided and writes it to w.
+//
+// The data is split in segments of 64K which are encrypted and authenticated
+// individually, so it can be used for data of any size in constant memory. The
+// segments are numbered and the last one is marked as such, so NewDecryptReader
+// will detect if segments were removed, reordered, or truncated.
+//
+// The Close method must be called to write the final segment; it doesn't close
+// w.
+func NewEncryptWriter(w io.Writer, keyString string) (io.WriteCloser, error) {
+	header := make([]byte, streamHeaderSize)
+	header[0] = versionStream
+	if _, err := io.ReadFull(rand.Reader, header[1:]); err != nil {
+		return nil, err
+	}
+
+	aead, err := newStreamAEAD(keyString, header[1:])
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	return &encryptWriter{
+		w:      w,
+		aead:   aead,
+		header: header,
+		buf:    make([]byte, 0, streamSegmentSize+streamTagSize),
+	}, nil
+}
+
+// NewDecryptReader returns a reader which decrypts the data in r that was
+// written with NewEncryptWriter.
+//
+// Read returns an error as soon as a segment fails to authenticate, so data
+// returned before that may be part of a stream that's been tampered with or is
+// incomplete. Callers should not act on the data until io.EOF is returned.
+func NewDecryptReader(r io.Reader, keyString string) (io.Reader, error) {
+	header := make([]byte, streamHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, ErrStreamTruncated
+		}
+		return nil, err
+	}
+	if header[0] != versionStream {
+		return nil, errUnsupportedVersion(header)
+	}
+
+	aead, err := newStreamAEAD(keyString, header[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	return &decryptReader{
+		r:      bufio.NewReaderSize(r, streamSegmentSize+streamTagSize),
+		aead:   aead,
+		header: header,
+		buf:    make([]byte, streamSegmentSize+streamTagSize),
+		out:    make([]byte, 0, streamSegmentSize),
+	}, nil
+}
+
+// newStreamAEAD creates a GCM cipher with a key derived from the key and salt,
+// so that the nonce can be a simple counter.
+func newStreamAEAD(keyString string, salt []byte) (cipher.AEAD, error) {
+	key := []byte(keyString)
+	if _, err := aes.NewCipher(key); err != nil {
+		return nil, err
+	}
+
+	subkey, err := hkdf.Key(sha256.New, key, salt, streamInfo, len(key))
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(subkey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// streamNonce gets the nonce for a segment: 7 zero bytes, followed by the
+// segment counter and a flag to indicate the last segment.
+func streamNonce(nonce []byte, counter uint32, last bool) []byte {
+	clear(nonce)
+	binary.BigEndian.PutUint32(nonce[7:], counter)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+type encryptWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	header  []byte
+	buf     []byte
+	nonce   [12]byte
+	counter uint32
+	err     error
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	if e.err != nil {
+		return 0, e.err
+	}
+
+	n := 0
+	for len(p) > 0 {
+		// Only write a full segment once we know there's more data, as the
+		// last segment needs to be flagged.
+		if len(e.buf) == streamSegmentSize {
+			if err := e.flush(false); err != nil {
+				return n, err
+			}
+		}
+
+		c := copy(e.buf[len(e.buf):streamSegmentSize], p)
+		e.buf = e.buf[:len(e.buf)+c]
+		p = p[c:]
+		n += c
+	}
+	return n, nil
+}
+
+// Close writes the final segment.
+func (e *encryptWriter) Close() error {
+	if e.err != nil {
+		if e.err == errStreamClosed {
+			return nil
+		}
+		return e.err
+	}
+	if err := e.flush(true); err != nil {
+		return err
+	}
+	e.err = errStreamClosed
+	return nil
+}
+
+func (e *encryptWriter) flush(last bool) error {
+	if e.counter == 1<<32-1 {
+		e.err = errors.New("encrypted stream is too large")
+		return e.err
+	}
+
+	nonce := streamNonce(e.nonce[:], e.counter, last)
+	e.buf = e.aead.Seal(e.buf[:0], nonce, e.buf, e.header)
+	if _, err := e.w.Write(e.buf); err != nil {
+		e.err = err
+		return err
+	}
+
+	e.counter++
+	e.buf = e.buf[:0]
+	return nil
+}
+
+type decryptReader struct {
+	r       *bufio.Reader
+	aead    cipher.AEAD
+	header  []byte
+	buf     []byte
+	out     []byte
+	plain   []byte
+	nonce   [12]byte
+	counter uint32
+	done    bool
+	err     error
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		if d.done {
+			return 0, io.EOF
+		}
+		d.err = d.next()
+	}
+
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
+
+// next reads and decrypts the next segment.
+func (d *decryptReader) next() error {
+	n, err := io.ReadFull(d.r, d.buf)
+	switch {
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		// Short segment; must be the last one.
+		d.done = true
+	case errors.Is(err, io.EOF):
+		// Ended on a segment boundary without the last segment.
+		return ErrStreamTruncated
+	case err != nil:
+		return err
+	default:
+		// Full segment; it's the last one if there's nothing after it.
+		if _, err := d.r.Peek(1); errors.Is(err, io.EOF) {
+			d.done = true
+		} else if err != nil {
+			return err
+		}
+	}
+
+	if n < streamTagSize {
+		return ErrStreamTruncated
+	}
+
+	nonce := streamNonce(d.nonce[:], d.counter, d.done)
+	d.plain, err = d.aead.Open(d.out[:0], nonce, d.buf[:n], d.header)
+	if err != nil {
+		if d.done {
+			// A non-final segment at the end means the stream was
+			// truncated.
+			if _, err2 := d.aead.Open(d.out[:0], streamNonce(d.nonce[:], d.counter, false), d.buf[:n], d.header); err2 == nil {
+				return ErrStreamTruncated
+			}
+		}
+		return fmt.Errorf("segment %d: %w", d.counter, err)
+	}
+
+	d.counter++
+	return nil
+}
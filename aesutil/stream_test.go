@@ -0,0 +1,121 @@
+package aesutil
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func encryptStream(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w, err := NewEncryptWriter(&buf, testKeyString)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Write in odd-sized chunks to make sure segments are split correctly.
+	for len(data) > 0 {
+		n := min(len(data), 1000)
+		if _, err := w.Write(data[:n]); err != nil {
+			t.Fatal(err)
+		}
+		data = data[n:]
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func decryptStream(ciphertext []byte) ([]byte, error) {
+	r, err := NewDecryptReader(bytes.NewReader(ciphertext), testKeyString)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func TestStream(t *testing.T) {
+	for _, size := range []int{0, 1, streamSegmentSize - 1, streamSegmentSize, streamSegmentSize + 1, 3*streamSegmentSize + 42} {
+		t.Run(fmt.Sprintf("%d", size), func(t *testing.T) {
+			data := make([]byte, size)
+			_, _ = rand.Read(data)
+
+			ciphertext := encryptStream(t, data)
+			plain, err := decryptStream(ciphertext)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(plain, data) {
+				t.Fatalf("decrypted data differs (len %d, want %d)", len(plain), len(data))
+			}
+		})
+	}
+}
+
+func TestStreamTamper(t *testing.T) {
+	data := make([]byte, 2*streamSegmentSize+100)
+	_, _ = rand.Read(data)
+	ciphertext := encryptStream(t, data)
+	seg := streamSegmentSize + streamTagSize
+
+	tests := []struct {
+		name    string
+		in      []byte
+		wantErr error
+	}{
+		{"empty", nil, ErrStreamTruncated},
+		{"header only", ciphertext[:streamHeaderSize], ErrStreamTruncated},
+		{"truncated at segment", ciphertext[:streamHeaderSize+seg], ErrStreamTruncated},
+		{"truncated mid-segment", ciphertext[:streamHeaderSize+seg+100], nil},
+		{"trailing data", append(append([]byte{}, ciphertext...), 'x'), nil},
+		{"reordered", func() []byte {
+			c := append([]byte{}, ciphertext...)
+			first := append([]byte{}, c[streamHeaderSize:streamHeaderSize+seg]...)
+			copy(c[streamHeaderSize:], c[streamHeaderSize+seg:streamHeaderSize+2*seg])
+			copy(c[streamHeaderSize+seg:], first)
+			return c
+		}(), nil},
+		{"modified", func() []byte {
+			c := append([]byte{}, ciphertext...)
+			c[len(c)-50] ^= 1
+			return c
+		}(), nil},
+		{"modified header", func() []byte {
+			c := append([]byte{}, ciphertext...)
+			c[1] ^= 1
+			return c
+		}(), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decryptStream(tt.in)
+			if err == nil {
+				t.Fatal("no error")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("wrong error: %v", err)
+			}
+		})
+	}
+}
+
+func TestStreamInvalidKey(t *testing.T) {
+	if _, err := NewEncryptWriter(io.Discard, "short"); err == nil {
+		t.Error("NewEncryptWriter succeeded with invalid key")
+	}
+
+	ciphertext := encryptStream(t, []byte(testPlaintext))
+	r, err := NewDecryptReader(bytes.NewReader(ciphertext), "aaaaffff12345678")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(r); err == nil {
+		t.Error("decrypt succeeded with wrong key")
+	}
+}
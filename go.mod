@@ -3,9 +3,12 @@ module github.com/teamwork/utils/v2
 go 1.25
 
 require (
+	github.com/andybalholm/brotli v1.2.6
 	github.com/mattn/goveralls v0.0.12
 	github.com/pkg/errors v0.9.1
 	github.com/teamwork/test v0.0.0-20200108114543-02621bae84ad
+	golang.org/x/crypto v0.45.0
+	golang.org/x/sys v0.38.0
 	golang.org/x/tools v0.39.0
 )
 
@@ -0,0 +1,93 @@
+package httputilx
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/teamwork/utils/v2/httputilx/header"
+)
+
+// BackoffPolicy determines how long to wait before retrying a request.
+type BackoffPolicy interface {
+	// Backoff gets the time to wait before the given retry attempt, starting
+	// at 1. The previous wait is passed as prev, and is 0 for the first retry.
+	Backoff(attempt int, prev time.Duration) time.Duration
+}
+
+// BackoffPolicyFunc is an adapter to allow the use of ordinary functions as a
+// BackoffPolicy.
+type BackoffPolicyFunc func(attempt int, prev time.Duration) time.Duration
+
+// Backoff calls f(attempt, prev).
+func (f BackoffPolicyFunc) Backoff(attempt int, prev time.Duration) time.Duration {
+	return f(attempt, prev)
+}
+
+// ExponentialPolicy waits initial before the first retry, and multiplies this
+// by multiplier for every subsequent retry, up to maxBackoff.
+//
+// All clients using this policy will retry at the same time; consider using
+// FullJitterPolicy or DecorrelatedJitterPolicy instead.
+func ExponentialPolicy(initial, maxBackoff time.Duration, multiplier float64) BackoffPolicy {
+	return BackoffPolicyFunc(func(attempt int, _ time.Duration) time.Duration {
+		return exponential(initial, maxBackoff, multiplier, attempt)
+	})
+}
+
+// FullJitterPolicy waits a random time between 0 and the time that
+// ExponentialPolicy would wait.
+func FullJitterPolicy(initial, maxBackoff time.Duration, multiplier float64) BackoffPolicy {
+	return BackoffPolicyFunc(func(attempt int, _ time.Duration) time.Duration {
+		return rand.N(exponential(initial, maxBackoff, multiplier, attempt) + 1)
+	})
+}
+
+// DecorrelatedJitterPolicy waits a random time between base and three times the
+// previous wait, up to maxBackoff.
+func DecorrelatedJitterPolicy(base, maxBackoff time.Duration) BackoffPolicy {
+	return BackoffPolicyFunc(func(_ int, prev time.Duration) time.Duration {
+		upper := maxBackoff
+		if prev < maxBackoff/3 {
+			upper = prev * 3
+		}
+		if upper <= base {
+			return min(base, maxBackoff)
+		}
+		return min(base+rand.N(upper-base+1), maxBackoff)
+	})
+}
+
+func exponential(initial, maxBackoff time.Duration, multiplier float64, attempt int) time.Duration {
+	d := float64(initial)
+	for i := 1; i < attempt && d < float64(maxBackoff); i++ {
+		d *= multiplier
+	}
+	return min(time.Duration(d), maxBackoff)
+}
+
+// retryAfter gets the delay from the Retry-After header of 429 and 503
+// responses, which can be either a number of seconds or a HTTP date.
+func retryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	if resp == nil ||
+		(resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable) {
+		return 0, false
+	}
+
+	v := strings.TrimSpace(resp.Header.Get("Retry-After"))
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.ParseInt(v, 10, 64); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	if t := header.ParseTime(resp.Header, "Retry-After"); !t.IsZero() {
+		return max(t.Sub(now), 0), true
+	}
+	return 0, false
+}
@@ -0,0 +1,179 @@
+package httputilx
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestPolicies(t *testing.T) {
+	t.Run("exponential", func(t *testing.T) {
+		p := ExponentialPolicy(100*time.Millisecond, time.Second, 2)
+		want := []time.Duration{100, 200, 400, 800, 1000, 1000}
+		for i, w := range want {
+			if out := p.Backoff(i+1, 0); out != w*time.Millisecond {
+				t.Errorf("attempt %d\nout:  %v\nwant: %v", i+1, out, w*time.Millisecond)
+			}
+		}
+	})
+
+	t.Run("full jitter", func(t *testing.T) {
+		p := FullJitterPolicy(100*time.Millisecond, time.Second, 2)
+		for i := 0; i < 1000; i++ {
+			attempt := i%6 + 1
+			limit := ExponentialPolicy(100*time.Millisecond, time.Second, 2).Backoff(attempt, 0)
+			if out := p.Backoff(attempt, 0); out < 0 || out > limit {
+				t.Fatalf("attempt %d: %v not in [0, %v]", attempt, out, limit)
+			}
+		}
+	})
+
+	t.Run("decorrelated jitter", func(t *testing.T) {
+		p := DecorrelatedJitterPolicy(100*time.Millisecond, time.Second)
+		var prev time.Duration
+		for i := 0; i < 1000; i++ {
+			out := p.Backoff(i+1, prev)
+			if out < 100*time.Millisecond || out > time.Second || out > max(prev*3, 100*time.Millisecond) {
+				t.Fatalf("attempt %d: %v out of range (prev %v)", i+1, out, prev)
+			}
+			prev = out
+		}
+
+		if out := DecorrelatedJitterPolicy(time.Second, time.Millisecond).Backoff(1, 0); out != time.Millisecond {
+			t.Errorf("base larger than max: %v", out)
+		}
+	})
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		code   int
+		header string
+		want   time.Duration
+		wantOK bool
+	}{
+		{429, "5", 5 * time.Second, true},
+		{503, " 0 ", 0, true},
+		{503, "Wed, 01 Jan 2020 12:00:30 GMT", 30 * time.Second, true},
+		{503, "Wed, 01 Jan 2020 11:00:00 GMT", 0, true},
+		{429, "-1", 0, false},
+		{429, "soon", 0, false},
+		{429, "", 0, false},
+		{500, "5", 0, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(strconv.Itoa(tc.code)+" "+tc.header, func(t *testing.T) {
+			resp := &http.Response{StatusCode: tc.code, Header: http.Header{}}
+			if tc.header != "" {
+				resp.Header.Set("Retry-After", tc.header)
+			}
+			out, ok := retryAfter(resp, now)
+			if out != tc.want || ok != tc.wantOK {
+				t.Errorf("\nout:  %v %v\nwant: %v %v", out, ok, tc.want, tc.wantOK)
+			}
+		})
+	}
+}
+
+func TestDoExponentialBackoffLimits(t *testing.T) {
+	noWait := ExponentialBackoffWithPolicy(BackoffPolicyFunc(func(int, time.Duration) time.Duration { return 0 }))
+
+	tests := []struct {
+		name         string
+		options      []ExponentialBackoffOption
+		retryAfter   string
+		ctxTimeout   time.Duration
+		wantErr      error
+		wantCode     int
+		wantAttempts int
+	}{
+		{
+			name:         "RetryAfterRespected",
+			options:      []ExponentialBackoffOption{noWait, ExponentialBackoffWithMaxRetries(1)},
+			retryAfter:   "1",
+			wantCode:     http.StatusTooManyRequests,
+			wantAttempts: 2,
+		},
+		{
+			name:         "RetryAfterTooLong",
+			options:      []ExponentialBackoffOption{noWait},
+			retryAfter:   "3600",
+			wantCode:     http.StatusTooManyRequests,
+			wantAttempts: 1,
+		},
+		{
+			name:         "RetryAfterIgnored",
+			options:      []ExponentialBackoffOption{noWait, ExponentialBackoffWithMaxRetryAfter(0)},
+			retryAfter:   "3600",
+			wantCode:     http.StatusTooManyRequests,
+			wantAttempts: 4,
+		},
+		{
+			name: "MaxElapsed",
+			options: []ExponentialBackoffOption{
+				ExponentialBackoffWithPolicy(ExponentialPolicy(time.Hour, time.Hour, 1)),
+				ExponentialBackoffWithMaxElapsed(time.Minute),
+			},
+			wantCode:     http.StatusTooManyRequests,
+			wantAttempts: 1,
+		},
+		{
+			name: "ContextCancelled",
+			options: []ExponentialBackoffOption{
+				ExponentialBackoffWithPolicy(ExponentialPolicy(time.Hour, time.Hour, 1)),
+			},
+			ctxTimeout:   50 * time.Millisecond,
+			wantErr:      context.DeadlineExceeded,
+			wantAttempts: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempts++
+				if tt.retryAfter != "" {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+				w.WriteHeader(http.StatusTooManyRequests)
+			}))
+			defer ts.Close()
+
+			ctx := context.Background()
+			if tt.ctxTimeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.ctxTimeout)
+				defer cancel()
+			}
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			start := time.Now()
+			resp, err := DoExponentialBackoff(req, tt.options...)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("wrong error\nout:  %v\nwant: %v", err, tt.wantErr)
+			}
+			if err == nil {
+				defer resp.Body.Close() //nolint:errcheck
+				if resp.StatusCode != tt.wantCode {
+					t.Errorf("wrong status: %d", resp.StatusCode)
+				}
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("expected %d attempts, got %d", tt.wantAttempts, attempts)
+			}
+			if tt.retryAfter == "1" && time.Since(start) < time.Second {
+				t.Errorf("didn't wait for Retry-After: %v", time.Since(start))
+			}
+		})
+	}
+}
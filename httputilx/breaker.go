@@ -0,0 +1,312 @@
+package httputilx
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned when a request is rejected because the circuit
+// breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitState is the state of a circuit breaker.
+type CircuitState int
+
+// Circuit breaker states.
+const (
+	CircuitClosed   CircuitState = iota // Requests are allowed.
+	CircuitOpen                         // Requests are rejected.
+	CircuitHalfOpen                     // A single trial request is allowed.
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("CircuitState(%d)", int(s))
+	}
+}
+
+// CircuitBreaker stops sending requests to a host after a number of
+// consecutive failures, so that a downstream service which is down isn't
+// overloaded with requests.
+//
+// Every host (or other key) has its own circuit, which starts closed. After
+// the failure threshold is reached the circuit opens, and all requests are
+// rejected with ErrCircuitOpen for the cool-down period. After that the circuit
+// is half-open, and a single trial request is allowed: the circuit closes if it
+// succeeds, or opens again if it fails.
+//
+// It can be used as a http.RoundTripper with Transport, or standalone with
+// Allow.
+type CircuitBreaker struct {
+	threshold     int
+	cooldown      time.Duration
+	isFailure     func(resp *http.Response, err error) bool
+	onStateChange func(key string, from, to CircuitState)
+	logger        *slog.Logger
+	now           func() time.Time
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+type circuit struct {
+	state    CircuitState
+	failures int
+	since    time.Time // Time the circuit was opened, or the trial was started.
+	trial    uint64    // ID of the current trial request; 0 if none is in progress.
+	trials   uint64    // Number of trial requests, to generate IDs.
+}
+
+// CircuitBreakerOption is a function that configures a CircuitBreaker.
+type CircuitBreakerOption func(*CircuitBreaker)
+
+// CircuitBreakerWithThreshold sets the number of consecutive failures after
+// which the circuit opens. By default, this is 5.
+func CircuitBreakerWithThreshold(failures int) CircuitBreakerOption {
+	return func(b *CircuitBreaker) {
+		b.threshold = failures
+	}
+}
+
+// CircuitBreakerWithCooldown sets how long the circuit stays open before a trial
+// request is allowed. By default, this is 30s.
+func CircuitBreakerWithCooldown(cooldown time.Duration) CircuitBreakerOption {
+	return func(b *CircuitBreaker) {
+		b.cooldown = cooldown
+	}
+}
+
+// CircuitBreakerWithIsFailure sets the function to determine whether a request
+// failed. By default, the same classification as DoExponentialBackoff is used:
+// any error, as well as HTTP 5xx and 429 status codes.
+func CircuitBreakerWithIsFailure(
+	isFailure func(resp *http.Response, err error) bool,
+) CircuitBreakerOption {
+	return func(b *CircuitBreaker) {
+		b.isFailure = isFailure
+	}
+}
+
+// CircuitBreakerWithOnStateChange sets a function which is called when the
+// state of a circuit changes. It's called synchronously, after the state was
+// changed.
+func CircuitBreakerWithOnStateChange(
+	onStateChange func(key string, from, to CircuitState),
+) CircuitBreakerOption {
+	return func(b *CircuitBreaker) {
+		b.onStateChange = onStateChange
+	}
+}
+
+// CircuitBreakerWithLogger sets the logger to be used for logging state
+// changes. By default, a no-op logger is used.
+func CircuitBreakerWithLogger(logger *slog.Logger) CircuitBreakerOption {
+	return func(b *CircuitBreaker) {
+		b.logger = logger
+	}
+}
+
+// NewCircuitBreaker creates a new circuit breaker.
+func NewCircuitBreaker(options ...CircuitBreakerOption) *CircuitBreaker {
+	b := &CircuitBreaker{
+		threshold: 5,
+		cooldown:  30 * time.Second,
+		isFailure: defaultShouldRetry,
+		logger:    slog.New(slog.DiscardHandler),
+		now:       time.Now,
+		circuits:  make(map[string]*circuit),
+	}
+	for _, option := range options {
+		option(b)
+	}
+	return b
+}
+
+// State gets the current state of the circuit for key.
+func (b *CircuitBreaker) State(key string) CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if c, ok := b.circuits[key]; ok {
+		return c.state
+	}
+	return CircuitClosed
+}
+
+// Allow checks if a request for key may be sent, returning ErrCircuitOpen if it
+// may not. If the request is allowed the result must be reported by calling
+// record once:
+//
+//	record, err := breaker.Allow(host)
+//	if err != nil {
+//	    return err
+//	}
+//	err = doRequest()
+//	record(err != nil)
+//
+// Only the trial request can close or re-open a half-open circuit; results of
+// other requests are ignored unless the circuit is closed.
+func (b *CircuitBreaker) Allow(key string) (record func(failed bool), err error) {
+	trial, err := b.allow(key)
+	if err != nil {
+		return nil, err
+	}
+	return func(failed bool) { b.record(key, trial, failed) }, nil
+}
+
+// allow a request for key, returning the ID of the trial request if this is
+// one.
+func (b *CircuitBreaker) allow(key string) (uint64, error) {
+	b.mu.Lock()
+	c := b.circuit(key)
+	from := c.state
+	now := b.now()
+
+	var trial uint64
+	switch c.state {
+	case CircuitOpen:
+		if now.Sub(c.since) < b.cooldown {
+			b.mu.Unlock()
+			return 0, fmt.Errorf("%w: %s", ErrCircuitOpen, key)
+		}
+		c.state = CircuitHalfOpen
+		c.trials++
+		trial, c.trial, c.since = c.trials, c.trials, now
+	case CircuitHalfOpen:
+		// Allow a new trial if the previous one never reported back.
+		if c.trial != 0 && now.Sub(c.since) < b.cooldown {
+			b.mu.Unlock()
+			return 0, fmt.Errorf("%w: %s", ErrCircuitOpen, key)
+		}
+		c.trials++
+		trial, c.trial, c.since = c.trials, c.trials, now
+	}
+	to := c.state
+	b.mu.Unlock()
+
+	b.changed(key, from, to)
+	return trial, nil
+}
+
+// release a trial request without recording a result, so that a new trial can
+// be started right away.
+func (b *CircuitBreaker) release(key string, trial uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if c := b.circuit(key); trial != 0 && c.trial == trial {
+		c.trial = 0
+	}
+}
+
+// record the result of a request for key; trial is the ID of the trial request,
+// or 0 if it wasn't a trial.
+func (b *CircuitBreaker) record(key string, trial uint64, failed bool) {
+	b.mu.Lock()
+	c := b.circuit(key)
+	from := c.state
+
+	switch {
+	case trial != 0:
+		// A trial that reported back too late is ignored.
+		if c.state != CircuitHalfOpen || c.trial != trial {
+			break
+		}
+		if failed {
+			c.state, c.since, c.trial = CircuitOpen, b.now(), 0
+		} else {
+			c.state, c.failures, c.trial = CircuitClosed, 0, 0
+		}
+	case c.state != CircuitClosed:
+		// Requests allowed before the circuit opened.
+	case !failed:
+		c.failures = 0
+	default:
+		c.failures++
+		if c.failures >= b.threshold {
+			c.state, c.since = CircuitOpen, b.now()
+		}
+	}
+	to := c.state
+	failures := c.failures
+	b.mu.Unlock()
+
+	if from != to && to == CircuitOpen {
+		b.logger.Warn("circuit breaker opened",
+			slog.String("key", key),
+			slog.Int("failures", failures))
+	}
+	b.changed(key, from, to)
+}
+
+// Transport returns a http.RoundTripper which sends requests with next, or
+// http.DefaultTransport if nil. Every host has its own circuit.
+//
+// When combined with RetryTransport the circuit breaker should be the outer
+// transport, so that every request is counted once and requests aren't retried
+// when the circuit is open:
+//
+//	breaker.Transport(httputilx.NewRetryTransport(nil))
+func (b *CircuitBreaker) Transport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &breakerTransport{breaker: b, next: next}
+}
+
+func (b *CircuitBreaker) circuit(key string) *circuit {
+	c, ok := b.circuits[key]
+	if !ok {
+		c = &circuit{}
+		b.circuits[key] = c
+	}
+	return c
+}
+
+func (b *CircuitBreaker) changed(key string, from, to CircuitState) {
+	if from == to {
+		return
+	}
+	b.logger.Info("circuit breaker state changed",
+		slog.String("key", key),
+		slog.String("from", from.String()),
+		slog.String("to", to.String()))
+	if b.onStateChange != nil {
+		b.onStateChange(key, from, to)
+	}
+}
+
+type breakerTransport struct {
+	breaker *CircuitBreaker
+	next    http.RoundTripper
+}
+
+func (t *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	key := req.URL.Host
+	trial, err := t.breaker.allow(key)
+	if err != nil {
+		if req.Body != nil {
+			_ = req.Body.Close()
+		}
+		return nil, err
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	// Requests cancelled by the caller say nothing about the downstream
+	// service.
+	if req.Context().Err() != nil {
+		t.breaker.release(key, trial)
+		return resp, err
+	}
+	t.breaker.record(key, trial, t.breaker.isFailure(resp, err))
+	return resp, err
+}
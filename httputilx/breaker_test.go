@@ -0,0 +1,154 @@
+package httputilx
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	var changes []string
+	b := NewCircuitBreaker(
+		CircuitBreakerWithThreshold(2),
+		CircuitBreakerWithCooldown(time.Minute),
+		CircuitBreakerWithOnStateChange(func(key string, from, to CircuitState) {
+			changes = append(changes, key+": "+from.String()+" -> "+to.String())
+		}))
+	b.now = func() time.Time { return now }
+
+	allow := func(want error) func(bool) {
+		t.Helper()
+		record, err := b.Allow("a")
+		if !errors.Is(err, want) {
+			t.Fatalf("wrong error from Allow\nout:  %v\nwant: %v", err, want)
+		}
+		return record
+	}
+	state := func(want CircuitState) {
+		t.Helper()
+		if s := b.State("a"); s != want {
+			t.Fatalf("wrong state\nout:  %v\nwant: %v", s, want)
+		}
+	}
+
+	// Success resets the failure count.
+	allow(nil)(true)
+	allow(nil)(false)
+	allow(nil)(true)
+	state(CircuitClosed)
+
+	// Open after two consecutive failures.
+	slow := allow(nil)
+	allow(nil)(true)
+	state(CircuitOpen)
+	allow(ErrCircuitOpen)
+	if b.State("b") != CircuitClosed {
+		t.Fatal("other key is not closed")
+	}
+
+	// A request allowed before the circuit opened doesn't close it.
+	slow(false)
+	state(CircuitOpen)
+
+	// Half-open after the cool-down; only one trial request.
+	now = now.Add(time.Minute)
+	trial := allow(nil)
+	state(CircuitHalfOpen)
+	allow(ErrCircuitOpen)
+
+	// Failed trial opens it again.
+	trial(true)
+	state(CircuitOpen)
+	allow(ErrCircuitOpen)
+
+	// Trial that never reported back.
+	now = now.Add(time.Minute)
+	late := allow(nil)
+	now = now.Add(time.Minute)
+	trial = allow(nil)
+
+	// Only the current trial can close it.
+	late(false)
+	state(CircuitHalfOpen)
+	slow(false)
+	state(CircuitHalfOpen)
+
+	// Successful trial closes it.
+	trial(false)
+	state(CircuitClosed)
+
+	want := []string{
+		"a: closed -> open",
+		"a: open -> half-open",
+		"a: half-open -> open",
+		"a: open -> half-open",
+		"a: half-open -> closed",
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("\nout:  %#v\nwant: %#v", changes, want)
+	}
+}
+
+func TestCircuitBreakerTransport(t *testing.T) {
+	attempts := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	b := NewCircuitBreaker(CircuitBreakerWithThreshold(3))
+	client := &http.Client{Transport: b.Transport(nil)}
+
+	for i := 0; i < 5; i++ {
+		resp, err := client.Get(ts.URL)
+		if i < 3 {
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = resp.Body.Close()
+			continue
+		}
+		if !errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("wrong error: %v", err)
+		}
+	}
+	if attempts != 3 {
+		t.Errorf("expected 3 attempts, got %d", attempts)
+	}
+
+	u, _ := url.Parse(ts.URL)
+	if s := b.State(u.Host); s != CircuitOpen {
+		t.Errorf("wrong state: %v", s)
+	}
+}
+
+func TestCircuitBreakerTransportCancel(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer ts.Close()
+
+	b := NewCircuitBreaker(CircuitBreakerWithThreshold(1))
+	client := &http.Client{Transport: b.Transport(nil)}
+
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL, nil)
+		time.AfterFunc(10*time.Millisecond, cancel)
+		if _, err := client.Do(req); !errors.Is(err, context.Canceled) {
+			t.Fatalf("wrong error: %v", err)
+		}
+	}
+
+	u, _ := url.Parse(ts.URL)
+	if s := b.State(u.Host); s != CircuitClosed {
+		t.Errorf("wrong state: %v", s)
+	}
+}
@@ -0,0 +1,342 @@
+package httputilx
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// CassetteMode is the mode of a Cassette.
+type CassetteMode int
+
+// Cassette modes.
+const (
+	// CassetteReplay replays recorded responses. Requests without a recorded
+	// response are sent and recorded, unless CassetteWithStrict is used.
+	CassetteReplay CassetteMode = iota
+
+	// CassetteRecord sends all requests and records them, replacing any
+	// existing interactions.
+	CassetteRecord
+)
+
+// CassetteRequest is a recorded request.
+type CassetteRequest struct {
+	Method     string      `json:"method"`
+	URL        string      `json:"url"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+	BodyBase64 []byte      `json:"body_base64,omitempty"` // Used if the body isn't valid UTF-8.
+}
+
+// CassetteResponse is a recorded response.
+type CassetteResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+	BodyBase64 []byte      `json:"body_base64,omitempty"` // Used if the body isn't valid UTF-8.
+}
+
+// CassetteInteraction is a recorded request and its response.
+type CassetteInteraction struct {
+	Request  CassetteRequest  `json:"request"`
+	Response CassetteResponse `json:"response"`
+}
+
+// Cassette is a http.RoundTripper which records requests and responses to a
+// JSON file, and replays them later. This allows testing code that uses
+// third-party APIs without network access:
+//
+//	c, err := httputilx.NewCassette("testdata/api.json", httputilx.CassetteWithStrict())
+//	if err != nil {
+//	    t.Fatal(err)
+//	}
+//	t.Cleanup(func() { _ = c.Save() })
+//	client := &http.Client{Transport: c}
+//
+// To (re-)record the file, use CassetteWithMode(CassetteRecord).
+type Cassette struct {
+	path    string
+	mode    CassetteMode
+	strict  bool
+	next    http.RoundTripper
+	match   func(r *http.Request, body []byte, rec CassetteRequest) bool
+	redact  []string
+	changed bool
+
+	mu           sync.Mutex
+	interactions []CassetteInteraction
+	used         []bool
+}
+
+// CassetteOption is a function that configures a Cassette.
+type CassetteOption func(*Cassette)
+
+// CassetteWithMode sets the mode. By default, CassetteReplay is used.
+func CassetteWithMode(mode CassetteMode) CassetteOption {
+	return func(c *Cassette) {
+		c.mode = mode
+	}
+}
+
+// CassetteWithStrict makes requests without a recorded response fail with an
+// error in CassetteReplay mode, instead of sending and recording them.
+func CassetteWithStrict() CassetteOption {
+	return func(c *Cassette) {
+		c.strict = true
+	}
+}
+
+// CassetteWithTransport sets the transport used to send requests when
+// recording. By default, http.DefaultTransport is used.
+func CassetteWithTransport(next http.RoundTripper) CassetteOption {
+	return func(c *Cassette) {
+		c.next = next
+	}
+}
+
+// CassetteWithMatcher sets the function to determine whether a request matches
+// a recorded request. By default, the method, URL, and body must be identical.
+func CassetteWithMatcher(
+	match func(r *http.Request, body []byte, rec CassetteRequest) bool,
+) CassetteOption {
+	return func(c *Cassette) {
+		c.match = match
+	}
+}
+
+// CassetteWithRedactHeaders sets the request and response headers to redact
+// when recording. By default, Authorization, Proxy-Authorization, Cookie, and
+// Set-Cookie are redacted.
+func CassetteWithRedactHeaders(headers ...string) CassetteOption {
+	return func(c *Cassette) {
+		c.redact = headers
+	}
+}
+
+// MatchCassetteRequest is the default matcher: the method, URL, and body must
+// be identical.
+func MatchCassetteRequest(r *http.Request, body []byte, rec CassetteRequest) bool {
+	return r.Method == rec.Method && r.URL.String() == rec.URL && bytes.Equal(body, rec.body())
+}
+
+// NewCassette creates a new cassette, loading the interactions from path if it
+// exists.
+func NewCassette(path string, options ...CassetteOption) (*Cassette, error) {
+	c := &Cassette{
+		path:   path,
+		next:   http.DefaultTransport,
+		match:  MatchCassetteRequest,
+		redact: []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"},
+	}
+	for _, option := range options {
+		option(c)
+	}
+
+	if c.mode == CassetteRecord {
+		return c, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return c, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &c.interactions); err != nil {
+		return nil, errors.Wrapf(err, "cannot load cassette %v", path)
+	}
+	c.used = make([]bool, len(c.interactions))
+	return c, nil
+}
+
+// Interactions gets a copy of all interactions.
+func (c *Cassette) Interactions() []CassetteInteraction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]CassetteInteraction(nil), c.interactions...)
+}
+
+// Save writes the interactions to the file, if any were recorded.
+func (c *Cassette) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.changed {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(c.interactions, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(c.path, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	c.changed = false
+	return nil
+}
+
+// RoundTrip implements http.RoundTripper.
+func (c *Cassette) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.mode == CassetteReplay {
+		if rec, ok := c.find(req, body); ok {
+			return rec.response(req), nil
+		}
+		if c.strict {
+			return nil, fmt.Errorf("cassette %v: no recorded response for %v %v", c.path, req.Method, req.URL)
+		}
+	}
+
+	return c.record(req, body)
+}
+
+func (c *Cassette) find(req *http.Request, body []byte) (CassetteInteraction, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Prefer interactions that weren't replayed yet, so that the same request
+	// can have different responses.
+	found := -1
+	for i, rec := range c.interactions {
+		if !c.match(req, body, rec.Request) {
+			continue
+		}
+		if !c.used[i] {
+			found = i
+			break
+		}
+		if found == -1 {
+			found = i
+		}
+	}
+	if found == -1 {
+		return CassetteInteraction{}, false
+	}
+	c.used[found] = true
+	return c.interactions[found], true
+}
+
+func (c *Cassette) record(req *http.Request, body []byte) (*http.Response, error) {
+	send := req.Clone(req.Context())
+	if body != nil {
+		send.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	resp, err := c.next.RoundTrip(send)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	rec := CassetteInteraction{
+		Request: CassetteRequest{
+			Method: req.Method,
+			URL:    req.URL.String(),
+			Header: c.redactHeader(req.Header),
+		},
+		Response: CassetteResponse{
+			StatusCode: resp.StatusCode,
+			Header:     c.redactHeader(resp.Header),
+		},
+	}
+	rec.Request.Body, rec.Request.BodyBase64 = encodeCassetteBody(body)
+	rec.Response.Body, rec.Response.BodyBase64 = encodeCassetteBody(respBody)
+
+	c.mu.Lock()
+	c.interactions = append(c.interactions, rec)
+	c.used = append(c.used, true)
+	c.changed = true
+	c.mu.Unlock()
+
+	return resp, nil
+}
+
+func (c *Cassette) redactHeader(h http.Header) http.Header {
+	if len(h) == 0 {
+		return nil
+	}
+	h = h.Clone()
+	for _, k := range c.redact {
+		if _, ok := h[http.CanonicalHeaderKey(k)]; ok {
+			h.Set(k, "REDACTED")
+		}
+	}
+	return h
+}
+
+func (r CassetteRequest) body() []byte {
+	if r.BodyBase64 != nil {
+		return r.BodyBase64
+	}
+	if r.Body == "" {
+		return nil
+	}
+	return []byte(r.Body)
+}
+
+func (rec CassetteInteraction) response(req *http.Request) *http.Response {
+	body := rec.Response.BodyBase64
+	if body == nil {
+		body = []byte(rec.Response.Body)
+	}
+	header := rec.Response.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		Status:        strconv.Itoa(rec.Response.StatusCode) + " " + http.StatusText(rec.Response.StatusCode),
+		StatusCode:    rec.Response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+func encodeCassetteBody(b []byte) (string, []byte) {
+	if utf8.Valid(b) {
+		return string(b), nil
+	}
+	return "", b
+}
+
+// readRequestBody reads the request body without modifying the request, and
+// closes it. It returns nil if there is no body.
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	if req.GetBody != nil {
+		_ = req.Body.Close()
+		b, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		defer b.Close() // nolint: errcheck
+		return io.ReadAll(b)
+	}
+	defer req.Body.Close() // nolint: errcheck
+	return io.ReadAll(req.Body)
+}
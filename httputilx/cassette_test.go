@@ -0,0 +1,118 @@
+package httputilx
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/teamwork/test"
+)
+
+func TestCassette(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Set-Cookie", "session=secret")
+		w.Header().Set("X-Count", "x")
+		_, _ = w.Write([]byte(r.Method + " " + r.URL.Path + " " + string(body)))
+	}))
+	defer ts.Close()
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	do := func(c *Cassette, method, url, body string) (string, error) {
+		t.Helper()
+		req, err := http.NewRequest(method, ts.URL+url, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := (&http.Client{Transport: c}).Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close() // nolint: errcheck
+		out, err := io.ReadAll(resp.Body)
+		return string(out), err
+	}
+
+	// Record.
+	c, err := NewCassette(path, CassetteWithMode(CassetteRecord))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, body := range []string{"a", "b"} {
+		out, err := do(c, http.MethodPost, "/x", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != "POST /x "+body {
+			t.Errorf("wrong body: %q", out)
+		}
+	}
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 2 {
+		t.Fatalf("wrong number of requests: %d", requests)
+	}
+
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "secret") {
+		t.Errorf("headers not redacted:\n%s", data)
+	}
+
+	// Replay.
+	c, err = NewCassette(path, CassetteWithStrict())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, body := range []string{"b", "a", "a"} {
+		out, err := do(c, http.MethodPost, "/x", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != "POST /x "+body {
+			t.Errorf("wrong body: %q", out)
+		}
+	}
+	if _, err := do(c, http.MethodPost, "/x", "c"); !test.ErrorContains(err, "no recorded response for POST") {
+		t.Errorf("wrong error: %v", err)
+	}
+	if _, err := do(c, http.MethodGet, "/x", "a"); !test.ErrorContains(err, "no recorded response for GET") {
+		t.Errorf("wrong error: %v", err)
+	}
+	if requests != 2 {
+		t.Fatalf("requests sent while replaying: %d", requests)
+	}
+
+	// Non-strict records new requests.
+	c, err = NewCassette(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := do(c, http.MethodGet, "/y", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "GET /y " {
+		t.Errorf("wrong body: %q", out)
+	}
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 3 {
+		t.Fatalf("wrong number of requests: %d", requests)
+	}
+	c, err = NewCassette(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(c.Interactions()); n != 3 {
+		t.Errorf("wrong number of interactions: %d", n)
+	}
+}
@@ -0,0 +1,179 @@
+package header
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CacheControl is a Cache-Control header. Durations are nil if not set, and
+// are rounded down to seconds.
+//
+// https://www.rfc-editor.org/rfc/rfc9111#section-5.2
+// https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Cache-Control
+type CacheControl struct {
+	// Request and response directives
+	MaxAge       *time.Duration // max-age
+	NoCache      bool           // no-cache
+	NoStore      bool           // no-store
+	NoTransform  bool           // no-transform
+	StaleIfError *time.Duration // stale-if-error
+
+	// Request directives
+	MaxStale     *time.Duration // max-stale; math.MaxInt64 if set without a value
+	MinFresh     *time.Duration // min-fresh
+	OnlyIfCached bool           // only-if-cached
+
+	// Response directives
+	SMaxAge              *time.Duration // s-maxage
+	MustRevalidate       bool           // must-revalidate
+	ProxyRevalidate      bool           // proxy-revalidate
+	MustUnderstand       bool           // must-understand
+	Private              bool           // private
+	Public               bool           // public
+	Immutable            bool           // immutable
+	StaleWhileRevalidate *time.Duration // stale-while-revalidate
+
+	// Extensions are all other directives; the value is "" for directives
+	// without a value.
+	Extensions map[string]string
+}
+
+// ParseCacheControl parses the Cache-Control header. Directives with an invalid
+// value are ignored, and only the first is used if a directive occurs more than
+// once.
+func ParseCacheControl(header http.Header) CacheControl {
+	var (
+		cc   CacheControl
+		seen = make(map[string]bool)
+	)
+	for _, d := range ParseList(header, "Cache-Control") {
+		k, v, hasValue := strings.Cut(d, "=")
+		k = strings.ToLower(strings.TrimSpace(k))
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		v = strings.TrimSpace(v)
+		if strings.HasPrefix(v, `"`) {
+			v, _ = expectTokenOrQuoted(v)
+		}
+
+		dur := func(p **time.Duration) {
+			if n, err := strconv.ParseInt(v, 10, 64); err == nil && n >= 0 {
+				d := time.Duration(min(n, math.MaxInt64/int64(time.Second))) * time.Second
+				*p = &d
+			}
+		}
+		switch k {
+		case "max-age":
+			dur(&cc.MaxAge)
+		case "s-maxage":
+			dur(&cc.SMaxAge)
+		case "max-stale":
+			if hasValue {
+				dur(&cc.MaxStale)
+			} else {
+				d := time.Duration(math.MaxInt64)
+				cc.MaxStale = &d
+			}
+		case "min-fresh":
+			dur(&cc.MinFresh)
+		case "stale-while-revalidate":
+			dur(&cc.StaleWhileRevalidate)
+		case "stale-if-error":
+			dur(&cc.StaleIfError)
+		case "no-cache":
+			cc.NoCache = true
+		case "no-store":
+			cc.NoStore = true
+		case "no-transform":
+			cc.NoTransform = true
+		case "only-if-cached":
+			cc.OnlyIfCached = true
+		case "must-revalidate":
+			cc.MustRevalidate = true
+		case "proxy-revalidate":
+			cc.ProxyRevalidate = true
+		case "must-understand":
+			cc.MustUnderstand = true
+		case "private":
+			cc.Private = true
+		case "public":
+			cc.Public = true
+		case "immutable":
+			cc.Immutable = true
+		default:
+			if cc.Extensions == nil {
+				cc.Extensions = make(map[string]string)
+			}
+			cc.Extensions[k] = v
+		}
+	}
+	return cc
+}
+
+// String formats the header value.
+func (cc CacheControl) String() string {
+	var d []string
+	flag := func(set bool, name string) {
+		if set {
+			d = append(d, name)
+		}
+	}
+	dur := func(v *time.Duration, name string) {
+		if v != nil {
+			d = append(d, name+"="+strconv.FormatInt(int64(*v/time.Second), 10))
+		}
+	}
+
+	flag(cc.Public, "public")
+	flag(cc.Private, "private")
+	flag(cc.NoCache, "no-cache")
+	flag(cc.NoStore, "no-store")
+	dur(cc.MaxAge, "max-age")
+	dur(cc.SMaxAge, "s-maxage")
+	if cc.MaxStale != nil && *cc.MaxStale == math.MaxInt64 {
+		d = append(d, "max-stale")
+	} else {
+		dur(cc.MaxStale, "max-stale")
+	}
+	dur(cc.MinFresh, "min-fresh")
+	flag(cc.NoTransform, "no-transform")
+	flag(cc.OnlyIfCached, "only-if-cached")
+	flag(cc.MustRevalidate, "must-revalidate")
+	flag(cc.ProxyRevalidate, "proxy-revalidate")
+	flag(cc.MustUnderstand, "must-understand")
+	flag(cc.Immutable, "immutable")
+	dur(cc.StaleWhileRevalidate, "stale-while-revalidate")
+	dur(cc.StaleIfError, "stale-if-error")
+
+	ext := make([]string, 0, len(cc.Extensions))
+	for k, v := range cc.Extensions {
+		if v == "" {
+			ext = append(ext, k)
+			continue
+		}
+		if t, _ := expectToken(v); t != v {
+			v = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(v) + `"`
+		}
+		ext = append(ext, k+"="+v)
+	}
+	slices.Sort(ext)
+
+	return strings.Join(append(d, ext...), ", ")
+}
+
+// SetCacheControl sets the Cache-Control header. Any previous value will be
+// overwritten.
+func SetCacheControl(header http.Header, cc CacheControl) error {
+	if header == nil {
+		return errors.New("header is nil map")
+	}
+	header.Set("Cache-Control", cc.String())
+	return nil
+}
@@ -0,0 +1,74 @@
+package header
+
+import (
+	"math"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCacheControl(t *testing.T) {
+	dur := func(d time.Duration) *time.Duration { return &d }
+
+	tests := []struct {
+		in     string
+		want   CacheControl
+		format string // Defaults to in.
+	}{
+		{"", CacheControl{}, ""},
+		{"no-store", CacheControl{NoStore: true}, ""},
+		{
+			"public, max-age=3600, immutable",
+			CacheControl{Public: true, MaxAge: dur(time.Hour), Immutable: true},
+			"",
+		},
+		{
+			"Private, NO-CACHE, max-age=0, must-revalidate",
+			CacheControl{Private: true, NoCache: true, MaxAge: dur(0), MustRevalidate: true},
+			"private, no-cache, max-age=0, must-revalidate",
+		},
+		{
+			`s-maxage="60", stale-while-revalidate=30, stale-if-error=600`,
+			CacheControl{SMaxAge: dur(time.Minute), StaleWhileRevalidate: dur(30 * time.Second), StaleIfError: dur(10 * time.Minute)},
+			"s-maxage=60, stale-while-revalidate=30, stale-if-error=600",
+		},
+		{
+			"max-stale, min-fresh=10, only-if-cached, no-transform",
+			CacheControl{MaxStale: dur(math.MaxInt64), MinFresh: dur(10 * time.Second), OnlyIfCached: true, NoTransform: true},
+			"max-stale, min-fresh=10, no-transform, only-if-cached",
+		},
+		{"max-stale=5", CacheControl{MaxStale: dur(5 * time.Second)}, ""},
+		{
+			`max-age=10, max-age=20, max-age=x, s-maxage=-1`,
+			CacheControl{MaxAge: dur(10 * time.Second)},
+			"max-age=10",
+		},
+		{
+			`community="UCI, \"x\"", foo, bar=baz`,
+			CacheControl{Extensions: map[string]string{"community": `UCI, "x"`, "foo": "", "bar": "baz"}},
+			`bar=baz, community="UCI, \"x\"", foo`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			out := ParseCacheControl(http.Header{"Cache-Control": {tt.in}})
+			if !reflect.DeepEqual(out, tt.want) {
+				t.Errorf("\nout:  %+v\nwant: %+v\n", out, tt.want)
+			}
+
+			want := tt.format
+			if want == "" {
+				want = tt.in
+			}
+			h := http.Header{}
+			if err := SetCacheControl(h, out); err != nil {
+				t.Fatal(err)
+			}
+			if f := h.Get("Cache-Control"); f != want {
+				t.Errorf("\nformat: %#v\nwant:   %#v\n", f, want)
+			}
+		})
+	}
+}
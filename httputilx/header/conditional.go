@@ -0,0 +1,196 @@
+package header
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ETag is an entity tag.
+//
+// https://www.rfc-editor.org/rfc/rfc9110#section-8.8.3
+type ETag struct {
+	Tag  string // Without quotes.
+	Weak bool
+}
+
+// String formats the ETag as "tag" or W/"tag".
+func (e ETag) String() string {
+	if e.Weak {
+		return `W/"` + e.Tag + `"`
+	}
+	return `"` + e.Tag + `"`
+}
+
+// IsZero reports if this is the zero value.
+func (e ETag) IsZero() bool {
+	return e == ETag{}
+}
+
+// StrongMatch reports if both ETags are strong and identical; this is used for
+// If-Match and If-Range.
+func (e ETag) StrongMatch(o ETag) bool {
+	return !e.Weak && !o.Weak && e.Tag == o.Tag
+}
+
+// WeakMatch reports if both ETags are identical, ignoring whether they're weak;
+// this is used for If-None-Match.
+func (e ETag) WeakMatch(o ETag) bool {
+	return e.Tag == o.Tag
+}
+
+func validETag(tag string) error {
+	for i := 0; i < len(tag); i++ {
+		// etagc = %x21 / %x23-7E / obs-text
+		if c := tag[i]; c <= 0x20 || c == '"' || c == 0x7f {
+			return fmt.Errorf("invalid character %q in ETag", c)
+		}
+	}
+	return nil
+}
+
+// ParseETag parses an ETag as "tag" or W/"tag".
+func ParseETag(s string) (ETag, error) {
+	var e ETag
+	s = strings.TrimSpace(s)
+	if rest, ok := strings.CutPrefix(s, "W/"); ok {
+		e.Weak, s = true, rest
+	}
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return ETag{}, fmt.Errorf("invalid ETag %q: not quoted", s)
+	}
+	e.Tag = s[1 : len(s)-1]
+	if err := validETag(e.Tag); err != nil {
+		return ETag{}, err
+	}
+	return e, nil
+}
+
+// SetETag sets the ETag header. Any previous value will be overwritten.
+func SetETag(header http.Header, etag ETag) error {
+	if header == nil {
+		return errors.New("header is nil map")
+	}
+	if err := validETag(etag.Tag); err != nil {
+		return err
+	}
+	header.Set("ETag", etag.String())
+	return nil
+}
+
+// SetLastModified sets the Last-Modified header. Any previous value will be
+// overwritten.
+func SetLastModified(header http.Header, modtime time.Time) error {
+	if header == nil {
+		return errors.New("header is nil map")
+	}
+	header.Set("Last-Modified", modtime.UTC().Format(http.TimeFormat))
+	return nil
+}
+
+// ParseETagList parses a list of ETags, as used by If-Match and If-None-Match.
+// The bool is true if the value is "*". Invalid ETags are skipped.
+func ParseETagList(header http.Header, key string) (etags []ETag, star bool) {
+	for _, v := range ParseList(header, key) {
+		if v == "*" {
+			star = true
+			continue
+		}
+		if e, err := ParseETag(v); err == nil {
+			etags = append(etags, e)
+		}
+	}
+	return etags, star
+}
+
+// ParseIfRange parses the If-Range header, which is either an ETag or a date.
+// Both are the zero value if the header isn't present or invalid.
+func ParseIfRange(header http.Header) (ETag, time.Time) {
+	v := header.Get("If-Range")
+	if strings.HasPrefix(v, `"`) || strings.HasPrefix(v, "W/") {
+		e, _ := ParseETag(v)
+		return e, time.Time{}
+	}
+	return ETag{}, ParseTime(header, "If-Range")
+}
+
+// CheckPreconditions evaluates the If-Match, If-Unmodified-Since,
+// If-None-Match, and If-Modified-Since headers in the order from RFC 9110
+// section 13.2.2, for a resource with the given ETag and modification time;
+// either can be the zero value if not known. Use zero values for both if the
+// resource doesn't exist.
+//
+// It returns the status code to respond with: 304 Not Modified or 412
+// Precondition Failed, or 0 if the request should be processed:
+//
+//	if code := header.CheckPreconditions(r, etag, modtime); code != 0 {
+//	    w.WriteHeader(code)
+//	    return
+//	}
+//
+// The If-Range header is evaluated separately with CheckIfRange.
+func CheckPreconditions(r *http.Request, etag ETag, modtime time.Time) int {
+	exists := !etag.IsZero() || !modtime.IsZero()
+	modtime = modtime.Truncate(time.Second)
+
+	if _, ok := r.Header["If-Match"]; ok {
+		if !matchETags(r.Header, "If-Match", etag, exists, ETag.StrongMatch) {
+			return http.StatusPreconditionFailed
+		}
+	} else if t := ParseTime(r.Header, "If-Unmodified-Since"); !t.IsZero() && !modtime.IsZero() {
+		if modtime.After(t) {
+			return http.StatusPreconditionFailed
+		}
+	}
+
+	isGet := r.Method == http.MethodGet || r.Method == http.MethodHead
+	if _, ok := r.Header["If-None-Match"]; ok {
+		if matchETags(r.Header, "If-None-Match", etag, exists, ETag.WeakMatch) {
+			if isGet {
+				return http.StatusNotModified
+			}
+			return http.StatusPreconditionFailed
+		}
+	} else if t := ParseTime(r.Header, "If-Modified-Since"); isGet && !t.IsZero() && !modtime.IsZero() {
+		if !modtime.After(t) {
+			return http.StatusNotModified
+		}
+	}
+	return 0
+}
+
+// CheckIfRange reports if the Range header should be used, according to the
+// If-Range header. A range request for an ETag or modification time that
+// doesn't match should get the full resource.
+func CheckIfRange(r *http.Request, etag ETag, modtime time.Time) bool {
+	if r.Header.Get("If-Range") == "" {
+		return true
+	}
+	e, t := ParseIfRange(r.Header)
+	switch {
+	case !e.IsZero():
+		return e.StrongMatch(etag)
+	case !t.IsZero():
+		// The date must be an exact match.
+		return !modtime.IsZero() && modtime.Truncate(time.Second).Equal(t)
+	}
+	return false
+}
+
+func matchETags(h http.Header, key string, etag ETag, exists bool, match func(ETag, ETag) bool) bool {
+	etags, star := ParseETagList(h, key)
+	if star {
+		return exists
+	}
+	if etag.IsZero() {
+		return false
+	}
+	for _, e := range etags {
+		if match(e, etag) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,162 @@
+package header
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/teamwork/test"
+)
+
+func TestParseETag(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    ETag
+		wantErr string
+	}{
+		{`"abc"`, ETag{Tag: "abc"}, ""},
+		{` W/"abc" `, ETag{Tag: "abc", Weak: true}, ""},
+		{`""`, ETag{}, ""},
+		{`abc`, ETag{}, "not quoted"},
+		{`W/abc`, ETag{}, "not quoted"},
+		{`"a"b"`, ETag{}, "invalid character"},
+		{`"a b"`, ETag{}, "invalid character"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			out, err := ParseETag(tt.in)
+			if !test.ErrorContains(err, tt.wantErr) {
+				t.Fatalf("wrong error\nout:  %v\nwant: %v", err, tt.wantErr)
+			}
+			if out != tt.want {
+				t.Errorf("\nout:  %#v\nwant: %#v\n", out, tt.want)
+			}
+			if err == nil && tt.want.Tag != "" {
+				h := http.Header{}
+				if err := SetETag(h, out); err != nil {
+					t.Fatal(err)
+				}
+				if rt, _ := ParseETag(h.Get("ETag")); rt != out {
+					t.Errorf("round trip: %#v", rt)
+				}
+			}
+		})
+	}
+}
+
+func TestParseETagList(t *testing.T) {
+	h := http.Header{"If-None-Match": {`"a", W/"b,c"`, `invalid, "d"`}}
+	etags, star := ParseETagList(h, "If-None-Match")
+	want := []ETag{{Tag: "a"}, {Tag: "b,c", Weak: true}, {Tag: "d"}}
+	if star || !reflect.DeepEqual(etags, want) {
+		t.Errorf("\nout:  %#v %v\nwant: %#v\n", etags, star, want)
+	}
+
+	if _, star := ParseETagList(http.Header{"If-Match": {"*"}}, "If-Match"); !star {
+		t.Error("star is false")
+	}
+}
+
+func TestCheckPreconditions(t *testing.T) {
+	modtime := time.Date(2024, 1, 2, 3, 4, 5, 600, time.UTC)
+	before := modtime.Add(-time.Hour).Format(http.TimeFormat)
+	at := modtime.Format(http.TimeFormat)
+	etag := ETag{Tag: "v1"}
+
+	tests := []struct {
+		method  string
+		header  http.Header
+		etag    ETag
+		modtime time.Time
+		want    int
+	}{
+		{"GET", http.Header{}, etag, modtime, 0},
+
+		// If-None-Match
+		{"GET", http.Header{"If-None-Match": {`"v1"`}}, etag, modtime, 304},
+		{"HEAD", http.Header{"If-None-Match": {`W/"v1"`}}, etag, modtime, 304},
+		{"GET", http.Header{"If-None-Match": {`"v0", "v1"`}}, etag, modtime, 304},
+		{"GET", http.Header{"If-None-Match": {`"v0"`}}, etag, modtime, 0},
+		{"PUT", http.Header{"If-None-Match": {`"v1"`}}, etag, modtime, 412},
+		{"PUT", http.Header{"If-None-Match": {`*`}}, etag, modtime, 412},
+		{"PUT", http.Header{"If-None-Match": {`*`}}, ETag{}, time.Time{}, 0},
+
+		// If-Match
+		{"PUT", http.Header{"If-Match": {`"v1"`}}, etag, modtime, 0},
+		{"PUT", http.Header{"If-Match": {`"v0"`}}, etag, modtime, 412},
+		{"PUT", http.Header{"If-Match": {`W/"v1"`}}, etag, modtime, 412},
+		{"PUT", http.Header{"If-Match": {`*`}}, etag, modtime, 0},
+		{"PUT", http.Header{"If-Match": {`*`}}, ETag{}, time.Time{}, 412},
+		{"PUT", http.Header{"If-Match": {`"v1"`}}, ETag{}, modtime, 412},
+
+		// If-Modified-Since
+		{"GET", http.Header{"If-Modified-Since": {at}}, etag, modtime, 304},
+		{"GET", http.Header{"If-Modified-Since": {before}}, etag, modtime, 0},
+		{"GET", http.Header{"If-Modified-Since": {"invalid"}}, etag, modtime, 0},
+		{"GET", http.Header{"If-Modified-Since": {at}}, etag, time.Time{}, 0},
+		{"POST", http.Header{"If-Modified-Since": {at}}, etag, modtime, 0},
+		// If-None-Match takes precedence.
+		{"GET", http.Header{"If-Modified-Since": {at}, "If-None-Match": {`"v0"`}}, etag, modtime, 0},
+
+		// If-Unmodified-Since
+		{"PUT", http.Header{"If-Unmodified-Since": {at}}, etag, modtime, 0},
+		{"PUT", http.Header{"If-Unmodified-Since": {before}}, etag, modtime, 412},
+		// If-Match takes precedence.
+		{"PUT", http.Header{"If-Unmodified-Since": {before}, "If-Match": {`"v1"`}}, etag, modtime, 0},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/", nil)
+			r.Header = tt.header
+			if out := CheckPreconditions(r, tt.etag, tt.modtime); out != tt.want {
+				t.Errorf("\nout:  %d\nwant: %d\n", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckIfRange(t *testing.T) {
+	modtime := time.Date(2024, 1, 2, 3, 4, 5, 600, time.UTC)
+	etag := ETag{Tag: "v1"}
+
+	tests := []struct {
+		ifRange string
+		want    bool
+	}{
+		{"", true},
+		{`"v1"`, true},
+		{`"v0"`, false},
+		{`W/"v1"`, false},
+		{modtime.Format(http.TimeFormat), true},
+		{modtime.Add(-time.Hour).Format(http.TimeFormat), false},
+		{"invalid", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ifRange, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.ifRange != "" {
+				r.Header.Set("If-Range", tt.ifRange)
+			}
+			if out := CheckIfRange(r, etag, modtime); out != tt.want {
+				t.Errorf("\nout:  %v\nwant: %v\n", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetLastModified(t *testing.T) {
+	h := http.Header{}
+	tz := time.FixedZone("", 3600)
+	if err := SetLastModified(h, time.Date(2024, 1, 2, 3, 4, 5, 0, tz)); err != nil {
+		t.Fatal(err)
+	}
+	if out, want := h.Get("Last-Modified"), "Tue, 02 Jan 2024 02:04:05 GMT"; out != want {
+		t.Errorf("\nout:  %#v\nwant: %#v\n", out, want)
+	}
+}
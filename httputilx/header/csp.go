@@ -0,0 +1,369 @@
+package header
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// CSPDirective is a single directive in a CSP.
+type CSPDirective struct {
+	Name    string
+	Sources []string
+}
+
+// CSP is a Content-Security-Policy.
+//
+// The zero value is an empty policy. Directives are written in the order they
+// were added.
+type CSP struct {
+	Directives []CSPDirective
+}
+
+// NewCSP creates a new policy from CSPArgs.
+func NewCSP(args CSPArgs) *CSP {
+	p := &CSP{}
+	for _, a := range args {
+		if len(a) > 0 {
+			p.Add(a[0], a[1:]...)
+		}
+	}
+	return p
+}
+
+// ParseCSP parses a Content-Security-Policy header value.
+//
+// Directive names are lower-cased, and if a directive occurs more than once
+// only the first is used, like browsers do.
+func ParseCSP(v string) (*CSP, error) {
+	p := &CSP{}
+	for d := range strings.SplitSeq(v, ";") {
+		f := strings.Fields(d)
+		if len(f) == 0 {
+			continue
+		}
+		name := strings.ToLower(f[0])
+		for _, c := range name {
+			if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-') {
+				return nil, fmt.Errorf("invalid CSP directive name %q", f[0])
+			}
+		}
+		if p.index(name) >= 0 {
+			continue
+		}
+		p.Directives = append(p.Directives, CSPDirective{Name: name, Sources: f[1:]})
+	}
+	return p, nil
+}
+
+func (p *CSP) index(name string) int {
+	return slices.IndexFunc(p.Directives, func(d CSPDirective) bool { return d.Name == name })
+}
+
+// Get the sources for a directive; the bool is false if the directive doesn't
+// exist.
+func (p *CSP) Get(name string) ([]string, bool) {
+	i := p.index(name)
+	if i < 0 {
+		return nil, false
+	}
+	return p.Directives[i].Sources, true
+}
+
+// Add sources to a directive, creating it if it doesn't exist yet. Sources
+// that are already present are not added again, and CSPSourceNone is removed
+// once there are other sources.
+func (p *CSP) Add(name string, sources ...string) *CSP {
+	i := p.index(name)
+	if i < 0 {
+		p.Directives = append(p.Directives, CSPDirective{Name: name})
+		i = len(p.Directives) - 1
+	}
+
+	d := &p.Directives[i]
+	for _, s := range sources {
+		if !slices.Contains(d.Sources, s) {
+			d.Sources = append(d.Sources, s)
+		}
+	}
+	if len(d.Sources) > 1 {
+		d.Sources = slices.DeleteFunc(d.Sources, func(s string) bool { return s == CSPSourceNone })
+	}
+	return p
+}
+
+// Remove a directive.
+func (p *CSP) Remove(name string) *CSP {
+	p.Directives = slices.DeleteFunc(p.Directives, func(d CSPDirective) bool { return d.Name == name })
+	return p
+}
+
+// Merge adds all directives and sources from other to this policy.
+func (p *CSP) Merge(other *CSP) *CSP {
+	for _, d := range other.Directives {
+		p.Add(d.Name, d.Sources...)
+	}
+	return p
+}
+
+// Clone makes a deep copy.
+func (p *CSP) Clone() *CSP {
+	c := &CSP{Directives: make([]CSPDirective, len(p.Directives))}
+	for i, d := range p.Directives {
+		c.Directives[i] = CSPDirective{Name: d.Name, Sources: slices.Clone(d.Sources)}
+	}
+	return c
+}
+
+// WithNonce returns a copy of the policy with the nonce source added to the
+// directives, or CSPScriptSrc and CSPStyleSrc if none are given.
+//
+// A directive that doesn't exist is created from CSPDefaultSrc first, so that
+// the nonce doesn't loosen the policy. Nothing is added if neither exists, as
+// everything is already allowed.
+func (p *CSP) WithNonce(nonce string, directives ...string) *CSP {
+	if len(directives) == 0 {
+		directives = []string{CSPScriptSrc, CSPStyleSrc}
+	}
+	c := p.Clone()
+	def, hasDef := c.Get(CSPDefaultSrc)
+	for _, name := range directives {
+		if _, ok := c.Get(name); !ok {
+			if !hasDef {
+				continue
+			}
+			c.Add(name, def...)
+		}
+		c.Add(name, CSPSourceNonce(nonce))
+	}
+	return c
+}
+
+// String formats the policy as a header value.
+func (p *CSP) String() string {
+	var b strings.Builder
+	for i, d := range p.Directives {
+		if i > 0 {
+			b.WriteString("; ")
+		}
+		b.WriteString(d.Name)
+		for _, s := range d.Sources {
+			b.WriteByte(' ')
+			b.WriteString(s)
+		}
+	}
+	return b.String()
+}
+
+// Set the Content-Security-Policy header. Any previous value will be
+// overwritten.
+func (p *CSP) Set(header http.Header) {
+	header.Set("Content-Security-Policy", p.String())
+}
+
+// SetReportOnly sets the Content-Security-Policy-Report-Only header. Any
+// previous value will be overwritten.
+func (p *CSP) SetReportOnly(header http.Header) {
+	header.Set("Content-Security-Policy-Report-Only", p.String())
+}
+
+// CSPSourceNonce formats a nonce as a source.
+func CSPSourceNonce(nonce string) string {
+	return "'nonce-" + nonce + "'"
+}
+
+// CSPSourceSHA256 formats the SHA-256 hash of an inline script or style as a
+// source.
+func CSPSourceSHA256(content []byte) string {
+	h := sha256.Sum256(content)
+	return "'sha256-" + base64.StdEncoding.EncodeToString(h[:]) + "'"
+}
+
+// NewCSPNonce generates a new random nonce.
+func NewCSPNonce() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b) // Never returns an error.
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+type cspNonceKey struct{}
+
+// CSPNonce gets the nonce set by CSPMiddleware, or "" if there is none.
+func CSPNonce(ctx context.Context) string {
+	n, _ := ctx.Value(cspNonceKey{}).(string)
+	return n
+}
+
+// CSPMiddleware sets the policy on every response, with a new nonce for every
+// request added to CSPScriptSrc and CSPStyleSrc. Use CSPNonce to get the nonce
+// in the handler:
+//
+//	<script nonce="{{.Nonce}}">
+//
+// The Content-Security-Policy-Report-Only header is set if reportOnly is true.
+func CSPMiddleware(next http.Handler, policy *CSP, reportOnly bool) http.Handler {
+	policy = policy.Clone()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonce := NewCSPNonce()
+		p := policy.WithNonce(nonce)
+		if reportOnly {
+			p.SetReportOnly(w.Header())
+		} else {
+			p.Set(w.Header())
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), cspNonceKey{}, nonce)))
+	})
+}
+
+// CSPReport is a CSP violation report.
+type CSPReport struct {
+	DocumentURI        string
+	Referrer           string
+	BlockedURI         string
+	ViolatedDirective  string
+	EffectiveDirective string
+	OriginalPolicy     string
+	Disposition        string // "enforce" or "report"
+	SourceFile         string
+	Sample             string
+	StatusCode         int
+	LineNumber         int
+	ColumnNumber       int
+}
+
+// Sent to CSPReportURI with Content-Type application/csp-report.
+type cspReportURI struct {
+	Report struct {
+		DocumentURI        string `json:"document-uri"`
+		Referrer           string `json:"referrer"`
+		BlockedURI         string `json:"blocked-uri"`
+		ViolatedDirective  string `json:"violated-directive"`
+		EffectiveDirective string `json:"effective-directive"`
+		OriginalPolicy     string `json:"original-policy"`
+		Disposition        string `json:"disposition"`
+		SourceFile         string `json:"source-file"`
+		ScriptSample       string `json:"script-sample"`
+		StatusCode         int    `json:"status-code"`
+		LineNumber         int    `json:"line-number"`
+		ColumnNumber       int    `json:"column-number"`
+	} `json:"csp-report"`
+}
+
+// Sent to CSPReportTo with Content-Type application/reports+json.
+type cspReportTo struct {
+	Type string `json:"type"`
+	Body struct {
+		DocumentURL        string `json:"documentURL"`
+		Referrer           string `json:"referrer"`
+		BlockedURL         string `json:"blockedURL"`
+		EffectiveDirective string `json:"effectiveDirective"`
+		OriginalPolicy     string `json:"originalPolicy"`
+		Disposition        string `json:"disposition"`
+		SourceFile         string `json:"sourceFile"`
+		Sample             string `json:"sample"`
+		StatusCode         int    `json:"statusCode"`
+		LineNumber         int    `json:"lineNumber"`
+		ColumnNumber       int    `json:"columnNumber"`
+	} `json:"body"`
+}
+
+// maxCSPReport is the maximum size of a request to CSPReportHandler.
+const maxCSPReport = 64 * 1024
+
+// CSPReportHandler returns a handler which collects CSP violation reports, and
+// calls fn for every report. Both the report-uri (application/csp-report) and
+// report-to (application/reports+json) formats are accepted; reports of other
+// types sent to the report-to endpoint are ignored.
+func CSPReportHandler(fn func(r *http.Request, report CSPReport)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		reports, err := parseCSPReports(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, rep := range reports {
+			fn(r, rep)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func parseCSPReports(r *http.Request) ([]CSPReport, error) {
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxCSPReport+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxCSPReport {
+		return nil, errors.New("report too large")
+	}
+
+	ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch ct {
+	case "application/csp-report", "application/json":
+		var rep cspReportURI
+		if err := json.Unmarshal(data, &rep); err != nil {
+			return nil, fmt.Errorf("invalid report: %w", err)
+		}
+		rr := rep.Report
+		return []CSPReport{{
+			DocumentURI:        rr.DocumentURI,
+			Referrer:           rr.Referrer,
+			BlockedURI:         rr.BlockedURI,
+			ViolatedDirective:  rr.ViolatedDirective,
+			EffectiveDirective: rr.EffectiveDirective,
+			OriginalPolicy:     rr.OriginalPolicy,
+			Disposition:        rr.Disposition,
+			SourceFile:         rr.SourceFile,
+			Sample:             rr.ScriptSample,
+			StatusCode:         rr.StatusCode,
+			LineNumber:         rr.LineNumber,
+			ColumnNumber:       rr.ColumnNumber,
+		}}, nil
+
+	case "application/reports+json":
+		var reps []cspReportTo
+		if err := json.Unmarshal(data, &reps); err != nil {
+			return nil, fmt.Errorf("invalid report: %w", err)
+		}
+		out := make([]CSPReport, 0, len(reps))
+		for _, rep := range reps {
+			if rep.Type != "csp-violation" {
+				continue
+			}
+			b := rep.Body
+			out = append(out, CSPReport{
+				DocumentURI:        b.DocumentURL,
+				Referrer:           b.Referrer,
+				BlockedURI:         b.BlockedURL,
+				ViolatedDirective:  b.EffectiveDirective,
+				EffectiveDirective: b.EffectiveDirective,
+				OriginalPolicy:     b.OriginalPolicy,
+				Disposition:        b.Disposition,
+				SourceFile:         b.SourceFile,
+				Sample:             b.Sample,
+				StatusCode:         b.StatusCode,
+				LineNumber:         b.LineNumber,
+				ColumnNumber:       b.ColumnNumber,
+			})
+		}
+		return out, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported Content-Type %q", ct)
+	}
+}
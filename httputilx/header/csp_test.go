@@ -0,0 +1,175 @@
+package header
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/teamwork/test"
+)
+
+func TestParseCSP(t *testing.T) {
+	tests := []struct {
+		in, want, wantErr string
+	}{
+		{"", "", ""},
+		{"default-src 'self'", "default-src 'self'", ""},
+		{
+			" Default-Src  'self' example.com ;;script-src 'nonce-abc' 'strict-dynamic'; upgrade-insecure-requests ",
+			"default-src 'self' example.com; script-src 'nonce-abc' 'strict-dynamic'; upgrade-insecure-requests",
+			"",
+		},
+		{"img-src a.com; img-src b.com", "img-src a.com", ""},
+		{"img_src a.com", "", "invalid CSP directive name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			p, err := ParseCSP(tt.in)
+			if !test.ErrorContains(err, tt.wantErr) {
+				t.Fatalf("wrong error\nout:  %v\nwant: %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if out := p.String(); out != tt.want {
+				t.Errorf("\nout:  %#v\nwant: %#v\n", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestCSPMerge(t *testing.T) {
+	p := NewCSP(CSPArgs{
+		{CSPDefaultSrc, CSPSourceSelf},
+		{CSPObjectSrc, CSPSourceNone},
+	})
+	p.Merge(NewCSP(CSPArgs{
+		{CSPDefaultSrc, CSPSourceSelf, "cdn.example.com"},
+		{CSPObjectSrc, "a.com"},
+		{CSPReportTo, "csp"},
+	}))
+
+	want := "default-src 'self' cdn.example.com; object-src a.com; report-to csp"
+	if out := p.String(); out != want {
+		t.Errorf("\nout:  %#v\nwant: %#v\n", out, want)
+	}
+
+	p.Remove(CSPObjectSrc)
+	if _, ok := p.Get(CSPObjectSrc); ok {
+		t.Error("not removed")
+	}
+}
+
+func TestCSPWithNonce(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"img-src 'self'", "img-src 'self'"},
+		{"default-src 'self'", "default-src 'self'; script-src 'self' 'nonce-N'; style-src 'self' 'nonce-N'"},
+		{"script-src 'strict-dynamic'", "script-src 'strict-dynamic' 'nonce-N'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			p, err := ParseCSP(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out := p.WithNonce("N").String(); out != tt.want {
+				t.Errorf("\nout:  %#v\nwant: %#v\n", out, tt.want)
+			}
+			if out := p.String(); out != tt.in {
+				t.Errorf("original modified: %#v", out)
+			}
+		})
+	}
+}
+
+func TestCSPSourceSHA256(t *testing.T) {
+	// From https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Content-Security-Policy/script-src
+	out := CSPSourceSHA256([]byte(`var inline = 1;`))
+	want := "'sha256-B2yPHKaXnvFWtRChIbabYmUBFZdVfKKXHbWtWidDVF8='"
+	if out != want {
+		t.Errorf("\nout:  %#v\nwant: %#v\n", out, want)
+	}
+}
+
+func TestCSPMiddleware(t *testing.T) {
+	var nonces []string
+	h := CSPMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonces = append(nonces, CSPNonce(r.Context()))
+	}), NewCSP(CSPArgs{{CSPScriptSrc, CSPSourceStrictDynamic}}), true)
+
+	for range 2 {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		n := nonces[len(nonces)-1]
+		want := "script-src 'strict-dynamic' 'nonce-" + n + "'"
+		if out := rr.Header().Get("Content-Security-Policy-Report-Only"); out != want {
+			t.Errorf("\nout:  %#v\nwant: %#v\n", out, want)
+		}
+	}
+	if len(nonces[0]) != 24 || nonces[0] == nonces[1] {
+		t.Errorf("wrong nonces: %v", nonces)
+	}
+}
+
+func TestCSPReportHandler(t *testing.T) {
+	tests := []struct {
+		method, contentType, body string
+		wantCode                  int
+		want                      []CSPReport
+	}{
+		{
+			http.MethodPost, "application/csp-report",
+			`{"csp-report": {"document-uri": "https://example.com/", "blocked-uri": "inline",
+				"violated-directive": "script-src-elem", "line-number": 3}}`,
+			http.StatusNoContent,
+			[]CSPReport{{DocumentURI: "https://example.com/", BlockedURI: "inline",
+				ViolatedDirective: "script-src-elem", LineNumber: 3}},
+		},
+		{
+			http.MethodPost, "application/reports+json",
+			`[{"type": "csp-violation", "body": {"documentURL": "https://example.com/",
+				"blockedURL": "https://evil.com/x.js", "effectiveDirective": "script-src",
+				"disposition": "report"}},
+			 {"type": "deprecation", "body": {}}]`,
+			http.StatusNoContent,
+			[]CSPReport{{DocumentURI: "https://example.com/", BlockedURI: "https://evil.com/x.js",
+				ViolatedDirective: "script-src", EffectiveDirective: "script-src", Disposition: "report"}},
+		},
+		{http.MethodGet, "", "", http.StatusMethodNotAllowed, nil},
+		{http.MethodPost, "text/plain", "x", http.StatusBadRequest, nil},
+		{http.MethodPost, "application/csp-report", "{", http.StatusBadRequest, nil},
+		{http.MethodPost, "application/csp-report", strings.Repeat(" ", maxCSPReport+1), http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run("", func(t *testing.T) {
+			var got []CSPReport
+			h := CSPReportHandler(func(r *http.Request, report CSPReport) {
+				got = append(got, report)
+			})
+
+			req := httptest.NewRequest(tt.method, "/csp", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantCode {
+				t.Errorf("wrong code: %d", rr.Code)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("wrong reports: %#v", got)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("\nout:  %#v\nwant: %#v\n", got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
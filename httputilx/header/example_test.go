@@ -1,6 +1,7 @@
 package header_test
 
 import (
+	"fmt"
 	"net/http"
 
 	"github.com/teamwork/utils/v2/httputilx/header"
@@ -29,3 +30,17 @@ func ExampleSetContentDisposition() {
 
 	// Output:
 }
+
+func ExampleNegotiate() {
+	headers := http.Header{"Accept": {"text/*;q=0.5, application/json"}}
+	switch header.Negotiate(headers, "Accept", "application/json", "text/csv") {
+	case "application/json":
+		fmt.Println("JSON")
+	case "text/csv":
+		fmt.Println("CSV")
+	default:
+		fmt.Println(http.StatusNotAcceptable)
+	}
+
+	// Output: JSON
+}
@@ -171,7 +171,7 @@ type AcceptSpec struct {
 	Q     float64
 }
 
-// ParseAccept parses Accept* headers.
+// ParseAccept parses Accept* headers. Use Negotiate to pick the best offer.
 func ParseAccept(header http.Header, key string) (specs []AcceptSpec) {
 loop:
 	for _, s := range header[key] {
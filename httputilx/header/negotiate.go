@@ -0,0 +1,176 @@
+package header
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Negotiate picks the best offer for an Accept, Accept-Language,
+// Accept-Encoding, or Accept-Charset header, following the precedence rules
+// from RFC 9110 section 12.5:
+//
+//   - every offer gets the q-value of the most specific matching range, so
+//     "text/*;q=0, text/csv" accepts text/csv but nothing else from text;
+//   - offers with q=0 or without a matching range are never picked;
+//   - the offer with the highest q-value is picked; on a tie the first offer
+//     is picked, so list them in order of preference.
+//
+// Accept ranges match media types with wildcards (*/*, text/*) and parameters;
+// a range with parameters only matches offers which have the same parameters
+// (e.g. "text/html;level=1"). Accept-Language ranges match language tags as
+// prefixes, so "en" matches "en-GB". The "identity" encoding is acceptable
+// unless excluded.
+//
+// The first offer is returned if the header is not present, and "" if none of
+// the offers are acceptable, in which case 406 Not Acceptable can be sent.
+func Negotiate(header http.Header, key string, offers ...string) string {
+	if len(offers) == 0 {
+		return ""
+	}
+	key = http.CanonicalHeaderKey(key)
+	values, ok := header[key]
+	if !ok {
+		return offers[0]
+	}
+
+	ranges := parseAcceptRanges(values)
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		o := acceptRange{value: offer}
+		if key == "Accept" {
+			if p := parseAcceptRanges([]string{offer}); len(p) == 1 {
+				o = p[0]
+			}
+		}
+
+		q, spec := 0.0, -1
+		for _, r := range ranges {
+			if s := r.match(key, o); s > spec {
+				q, spec = r.q, s
+			}
+		}
+		if spec < 0 && key == "Accept-Encoding" && strings.EqualFold(offer, "identity") {
+			// Acceptable, but not preferred over listed encodings.
+			q = 0.001
+		}
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+type acceptRange struct {
+	value  string
+	params map[string]string
+	q      float64
+}
+
+// match reports how specific the range matches the offer, or -1 if it doesn't.
+func (r acceptRange) match(key string, offer acceptRange) int {
+	switch key {
+	case "Accept":
+		rType, rSub, _ := strings.Cut(r.value, "/")
+		oType, oSub, _ := strings.Cut(offer.value, "/")
+		switch {
+		case rType == "*" && rSub == "*":
+			return 0
+		case !strings.EqualFold(rType, oType):
+			return -1
+		case rSub == "*":
+			return 1
+		case !strings.EqualFold(rSub, oSub):
+			return -1
+		}
+		for k, v := range r.params {
+			if !strings.EqualFold(offer.params[k], v) {
+				return -1
+			}
+		}
+		return 2 + len(r.params)
+
+	case "Accept-Language":
+		if r.value == "*" {
+			return 0
+		}
+		if len(offer.value) < len(r.value) || !strings.EqualFold(offer.value[:len(r.value)], r.value) {
+			return -1
+		}
+		if len(offer.value) > len(r.value) && offer.value[len(r.value)] != '-' {
+			return -1
+		}
+		return len(r.value)
+
+	default:
+		if r.value == "*" {
+			return 0
+		}
+		if !strings.EqualFold(r.value, offer.value) {
+			return -1
+		}
+		return 1
+	}
+}
+
+// parseAcceptRanges parses Accept* headers like ParseAccept, but also parses
+// parameters and skips invalid elements instead of the rest of the header.
+func parseAcceptRanges(values []string) []acceptRange {
+	var ranges []acceptRange
+	for _, s := range values {
+		for s != "" {
+			var (
+				r     acceptRange
+				valid bool
+			)
+			r, valid, s = expectAcceptRange(skipSpace(s))
+			if valid {
+				ranges = append(ranges, r)
+			}
+
+			// Skip to the next element.
+			if i := strings.IndexByte(s, ','); i >= 0 {
+				s = s[i+1:]
+			} else {
+				s = ""
+			}
+		}
+	}
+	return ranges
+}
+
+func expectAcceptRange(s string) (acceptRange, bool, string) {
+	r := acceptRange{q: 1}
+	r.value, s = expectTokenSlash(s)
+	if r.value == "" || strings.Count(r.value, "/") > 1 {
+		return r, false, s
+	}
+
+	for {
+		s = skipSpace(s)
+		if !strings.HasPrefix(s, ";") {
+			return r, true, s
+		}
+		var k, v string
+		k, s = expectToken(skipSpace(s[1:]))
+		k = strings.ToLower(k)
+		if k == "" || !strings.HasPrefix(s, "=") {
+			return r, false, s
+		}
+		if k == "q" {
+			// Anything after the weight are extension parameters, which we
+			// ignore.
+			var rest string
+			r.q, rest = expectQuality(s[1:])
+			if r.q < 0 || r.q > 1 {
+				// expectQuality doesn't return the rest on errors.
+				return r, false, s
+			}
+			return r, true, rest
+		}
+		v, s = expectTokenOrQuoted(s[1:])
+		if r.params == nil {
+			r.params = make(map[string]string)
+		}
+		r.params[k] = v
+	}
+}
@@ -0,0 +1,80 @@
+package header
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		key, header string
+		offers      string
+		want        string
+	}{
+		// Accept
+		{"Accept", "", "application/json text/csv", ""},
+		{"Accept", "text/csv", "application/json text/csv", "text/csv"},
+		{"Accept", "*/*", "application/json text/csv", "application/json"},
+		{"Accept", "text/*", "application/json text/csv", "text/csv"},
+		{"Accept", "TEXT/CSV", "application/json text/csv", "text/csv"},
+		{"Accept", "text/csv;q=0.5, application/json;q=0.9", "text/csv application/json", "application/json"},
+		{"Accept", "text/csv, */*;q=0.1", "application/json text/csv", "text/csv"},
+		{"Accept", "*/*, application/json;q=0", "application/json text/csv", "text/csv"},
+		{"Accept", "text/*;q=0, text/csv", "text/html text/csv", "text/csv"},
+		{"Accept", "application/json;q=0", "application/json", ""},
+		{"Accept", "text/html;level=1, text/html;q=0.5", "text/html text/html;level=1", "text/html;level=1"},
+		{"Accept", `text/html;level="1";q=0.7`, "text/html text/html;level=2", ""},
+		{"Accept", "text/html;level=1;q=0.3, text/html;q=0.7", "text/html;level=1 text/html", "text/html"},
+		{"Accept", "text/html;q=0.5;ext=foo", "text/html", "text/html"},
+		{"Accept", "garbage, text/csv;q=2, text/csv;q=0.2", "text/csv", "text/csv"},
+		{"Accept", "text/csv/x, application/json", "text/csv application/json", "application/json"},
+
+		// Accept-Language
+		{"Accept-Language", "en", "nl en-GB", "en-GB"},
+		{"Accept-Language", "en-GB", "en nl", ""},
+		{"Accept-Language", "eng", "en", ""},
+		{"Accept-Language", "nl;q=0.5, en;q=0.8", "nl en-US", "en-US"},
+		{"Accept-Language", "*, de;q=0", "de nl", "nl"},
+		{"Accept-Language", "en, en-GB;q=0", "en-GB en-US", "en-US"},
+
+		// Accept-Encoding
+		{"Accept-Encoding", "gzip, br;q=0.9", "br gzip identity", "gzip"},
+		{"Accept-Encoding", "gzip;q=0.5", "identity gzip", "gzip"},
+		{"Accept-Encoding", "br", "gzip identity", "identity"},
+		{"Accept-Encoding", "", "gzip identity", "identity"},
+		{"Accept-Encoding", "identity;q=0", "identity", ""},
+		{"Accept-Encoding", "*;q=0", "gzip identity", ""},
+		{"Accept-Encoding", "*;q=0, identity", "gzip identity", "identity"},
+
+		// Accept-Charset
+		{"Accept-Charset", "utf-8, iso-8859-1;q=0.5", "iso-8859-1 UTF-8", "UTF-8"},
+		{"Accept-Charset", "*;q=0.1, utf-8", "iso-8859-1 utf-8", "utf-8"},
+		{"Accept-Charset", "utf-16", "utf-8", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key+": "+tt.header, func(t *testing.T) {
+			header := http.Header{tt.key: {tt.header}}
+			if out := Negotiate(header, tt.key, strings.Fields(tt.offers)...); out != tt.want {
+				t.Errorf("\noffers: %v\nout:    %#v\nwant:   %#v\n", tt.offers, out, tt.want)
+			}
+		})
+	}
+
+	t.Run("no header", func(t *testing.T) {
+		if out := Negotiate(http.Header{}, "accept", "text/csv", "application/json"); out != "text/csv" {
+			t.Errorf("wrong offer: %#v", out)
+		}
+		if out := Negotiate(http.Header{}, "Accept"); out != "" {
+			t.Errorf("wrong offer: %#v", out)
+		}
+	})
+
+	t.Run("multiple headers", func(t *testing.T) {
+		header := http.Header{"Accept": {"text/csv;q=0.5", "application/json"}}
+		if out := Negotiate(header, "Accept", "text/csv", "application/json"); out != "application/json" {
+			t.Errorf("wrong offer: %#v", out)
+		}
+	})
+}
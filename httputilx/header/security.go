@@ -0,0 +1,316 @@
+package header
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HSTSArgs are arguments for SetHSTS().
+type HSTSArgs struct {
+	MaxAge            time.Duration // max-age, rounded down to seconds
+	IncludeSubdomains bool          // includeSubDomains
+	Preload           bool          // preload; requires IncludeSubdomains and a MaxAge of at least a year
+}
+
+// SetHSTS sets the Strict-Transport-Security header. Any previous value will be
+// overwritten.
+//
+// Browsers ignore this header on plain HTTP responses.
+//
+// https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Strict-Transport-Security
+func SetHSTS(header http.Header, args HSTSArgs) error {
+	if header == nil {
+		return errors.New("header is nil map")
+	}
+	if args.MaxAge < 0 {
+		return errors.New("the MaxAge field must not be negative")
+	}
+	if args.Preload && (!args.IncludeSubdomains || args.MaxAge < 365*24*time.Hour) {
+		return errors.New("the Preload field requires IncludeSubdomains and a MaxAge of at least a year")
+	}
+
+	v := "max-age=" + strconv.FormatInt(int64(args.MaxAge/time.Second), 10)
+	if args.IncludeSubdomains {
+		v += "; includeSubDomains"
+	}
+	if args.Preload {
+		v += "; preload"
+	}
+	header.Set("Strict-Transport-Security", v)
+	return nil
+}
+
+// SetContentTypeOptions sets the X-Content-Type-Options header to "nosniff".
+//
+// https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/X-Content-Type-Options
+func SetContentTypeOptions(header http.Header) error {
+	if header == nil {
+		return errors.New("header is nil map")
+	}
+	header.Set("X-Content-Type-Options", "nosniff")
+	return nil
+}
+
+// Referrer-Policy values.
+const (
+	ReferrerPolicyNoReferrer                  = "no-referrer"
+	ReferrerPolicyNoReferrerWhenDowngrade     = "no-referrer-when-downgrade"
+	ReferrerPolicyOrigin                      = "origin"
+	ReferrerPolicyOriginWhenCrossOrigin       = "origin-when-cross-origin"
+	ReferrerPolicySameOrigin                  = "same-origin"
+	ReferrerPolicyStrictOrigin                = "strict-origin"
+	ReferrerPolicyStrictOriginWhenCrossOrigin = "strict-origin-when-cross-origin"
+	ReferrerPolicyUnsafeURL                   = "unsafe-url"
+)
+
+// SetReferrerPolicy sets the Referrer-Policy header. Any previous value will be
+// overwritten.
+//
+// https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Referrer-Policy
+func SetReferrerPolicy(header http.Header, policy string) error {
+	return setEnum(header, "Referrer-Policy", policy, ReferrerPolicyNoReferrer,
+		ReferrerPolicyNoReferrerWhenDowngrade, ReferrerPolicyOrigin,
+		ReferrerPolicyOriginWhenCrossOrigin, ReferrerPolicySameOrigin,
+		ReferrerPolicyStrictOrigin, ReferrerPolicyStrictOriginWhenCrossOrigin,
+		ReferrerPolicyUnsafeURL)
+}
+
+// Permissions-Policy allowlist values; anything else is an origin.
+const (
+	PermissionsSelf = "self" // Same origin as the document
+	PermissionsStar = "*"    // All origins
+)
+
+// PermissionsPolicyArgs are arguments for SetPermissionsPolicy(); every entry is
+// a feature followed by its allowlist. A feature without an allowlist is
+// disabled:
+//
+//	header.PermissionsPolicyArgs{
+//	    {"camera"},
+//	    {"geolocation", header.PermissionsSelf, "https://maps.example.com"},
+//	}
+type PermissionsPolicyArgs [][]string
+
+// SetPermissionsPolicy sets the Permissions-Policy header. Any previous value
+// will be overwritten.
+//
+// https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Permissions-Policy
+func SetPermissionsPolicy(header http.Header, args PermissionsPolicyArgs) error {
+	if header == nil {
+		return errors.New("header is nil map")
+	}
+
+	var b strings.Builder
+	for i, v := range args {
+		if len(v) == 0 || v[0] == "" {
+			return errors.New("feature name is mandatory")
+		}
+		for _, c := range []byte(v[0]) {
+			if octetTypes[c]&isToken == 0 {
+				return fmt.Errorf("invalid feature name %q", v[0])
+			}
+		}
+
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(v[0])
+		if len(v) == 2 && v[1] == PermissionsStar {
+			b.WriteString("=*")
+			continue
+		}
+
+		b.WriteString("=(")
+		for j, o := range v[1:] {
+			if j > 0 {
+				b.WriteByte(' ')
+			}
+			switch {
+			case o == PermissionsSelf:
+				b.WriteString(o)
+			case o == PermissionsStar || strings.ContainsAny(o, "\"\\ ") || o == "":
+				return fmt.Errorf("invalid origin %q for %v", o, v[0])
+			default:
+				b.WriteString(`"` + o + `"`)
+			}
+		}
+		b.WriteByte(')')
+	}
+
+	header.Set("Permissions-Policy", b.String())
+	return nil
+}
+
+// Cross-Origin-Opener-Policy values.
+const (
+	COOPUnsafeNone            = "unsafe-none"
+	COOPSameOriginAllowPopups = "same-origin-allow-popups"
+	COOPSameOrigin            = "same-origin"
+)
+
+// SetCrossOriginOpenerPolicy sets the Cross-Origin-Opener-Policy header. Any
+// previous value will be overwritten.
+//
+// https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Cross-Origin-Opener-Policy
+func SetCrossOriginOpenerPolicy(header http.Header, policy string) error {
+	return setEnum(header, "Cross-Origin-Opener-Policy", policy,
+		COOPUnsafeNone, COOPSameOriginAllowPopups, COOPSameOrigin)
+}
+
+// Cross-Origin-Embedder-Policy values.
+const (
+	COEPUnsafeNone     = "unsafe-none"
+	COEPRequireCORP    = "require-corp"
+	COEPCredentialless = "credentialless"
+)
+
+// SetCrossOriginEmbedderPolicy sets the Cross-Origin-Embedder-Policy header.
+// Any previous value will be overwritten.
+//
+// https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Cross-Origin-Embedder-Policy
+func SetCrossOriginEmbedderPolicy(header http.Header, policy string) error {
+	return setEnum(header, "Cross-Origin-Embedder-Policy", policy,
+		COEPUnsafeNone, COEPRequireCORP, COEPCredentialless)
+}
+
+// Cross-Origin-Resource-Policy values.
+const (
+	CORPSameSite    = "same-site"
+	CORPSameOrigin  = "same-origin"
+	CORPCrossOrigin = "cross-origin"
+)
+
+// SetCrossOriginResourcePolicy sets the Cross-Origin-Resource-Policy header.
+// Any previous value will be overwritten.
+//
+// https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Cross-Origin-Resource-Policy
+func SetCrossOriginResourcePolicy(header http.Header, policy string) error {
+	return setEnum(header, "Cross-Origin-Resource-Policy", policy,
+		CORPSameSite, CORPSameOrigin, CORPCrossOrigin)
+}
+
+// X-Frame-Options values.
+const (
+	FrameOptionsDeny       = "DENY"
+	FrameOptionsSameOrigin = "SAMEORIGIN"
+)
+
+// SetFrameOptions sets the X-Frame-Options header. Any previous value will be
+// overwritten.
+//
+// This is superseded by CSPFrameAncestors, but still useful for older browsers.
+//
+// https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/X-Frame-Options
+func SetFrameOptions(header http.Header, option string) error {
+	return setEnum(header, "X-Frame-Options", option, FrameOptionsDeny, FrameOptionsSameOrigin)
+}
+
+func setEnum(header http.Header, key, value string, valid ...string) error {
+	if header == nil {
+		return errors.New("header is nil map")
+	}
+	if !slices.Contains(valid, value) {
+		return fmt.Errorf("invalid %v value %q", key, value)
+	}
+	header.Set(key, value)
+	return nil
+}
+
+// SecurityHeaders is a set of security headers. Headers with a zero value are
+// not set.
+type SecurityHeaders struct {
+	HSTS                      *HSTSArgs
+	ContentTypeOptions        bool
+	ReferrerPolicy            string
+	PermissionsPolicy         PermissionsPolicyArgs
+	CrossOriginOpenerPolicy   string
+	CrossOriginEmbedderPolicy string
+	CrossOriginResourcePolicy string
+	FrameOptions              string
+	CSP                       *CSP
+}
+
+// DefaultSecurityHeaders returns secure defaults, suitable for most HTML pages
+// and APIs:
+//
+//	Strict-Transport-Security:    max-age=63072000; includeSubDomains
+//	X-Content-Type-Options:       nosniff
+//	Referrer-Policy:              strict-origin-when-cross-origin
+//	Permissions-Policy:           camera=(), microphone=(), geolocation=()
+//	Cross-Origin-Opener-Policy:   same-origin
+//	Cross-Origin-Resource-Policy: same-origin
+//	X-Frame-Options:              DENY
+//
+// Cross-Origin-Embedder-Policy and Content-Security-Policy are not set, as they
+// depend on the resources the page loads.
+func DefaultSecurityHeaders() SecurityHeaders {
+	return SecurityHeaders{
+		HSTS:                      &HSTSArgs{MaxAge: 2 * 365 * 24 * time.Hour, IncludeSubdomains: true},
+		ContentTypeOptions:        true,
+		ReferrerPolicy:            ReferrerPolicyStrictOriginWhenCrossOrigin,
+		PermissionsPolicy:         PermissionsPolicyArgs{{"camera"}, {"microphone"}, {"geolocation"}},
+		CrossOriginOpenerPolicy:   COOPSameOrigin,
+		CrossOriginResourcePolicy: CORPSameOrigin,
+		FrameOptions:              FrameOptionsDeny,
+	}
+}
+
+// Set all headers. Any previous values will be overwritten.
+func (s SecurityHeaders) Set(header http.Header) error {
+	if header == nil {
+		return errors.New("header is nil map")
+	}
+
+	var errs []error
+	if s.HSTS != nil {
+		errs = append(errs, SetHSTS(header, *s.HSTS))
+	}
+	if s.ContentTypeOptions {
+		errs = append(errs, SetContentTypeOptions(header))
+	}
+	if s.ReferrerPolicy != "" {
+		errs = append(errs, SetReferrerPolicy(header, s.ReferrerPolicy))
+	}
+	if s.PermissionsPolicy != nil {
+		errs = append(errs, SetPermissionsPolicy(header, s.PermissionsPolicy))
+	}
+	if s.CrossOriginOpenerPolicy != "" {
+		errs = append(errs, SetCrossOriginOpenerPolicy(header, s.CrossOriginOpenerPolicy))
+	}
+	if s.CrossOriginEmbedderPolicy != "" {
+		errs = append(errs, SetCrossOriginEmbedderPolicy(header, s.CrossOriginEmbedderPolicy))
+	}
+	if s.CrossOriginResourcePolicy != "" {
+		errs = append(errs, SetCrossOriginResourcePolicy(header, s.CrossOriginResourcePolicy))
+	}
+	if s.FrameOptions != "" {
+		errs = append(errs, SetFrameOptions(header, s.FrameOptions))
+	}
+	if s.CSP != nil {
+		s.CSP.Set(header)
+	}
+	return errors.Join(errs...)
+}
+
+// SecurityHeadersMiddleware sets the headers on every response, before calling
+// next; handlers can still change or remove them.
+//
+// It panics if the headers are invalid.
+func SecurityHeadersMiddleware(next http.Handler, s SecurityHeaders) http.Handler {
+	set := make(http.Header)
+	if err := s.Set(set); err != nil {
+		panic(fmt.Sprintf("header.SecurityHeadersMiddleware: %v", err))
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		for k, v := range set {
+			h[k] = slices.Clone(v)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,145 @@
+package header
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/teamwork/test"
+	"github.com/teamwork/test/diff"
+)
+
+func TestSetHSTS(t *testing.T) {
+	year := 365 * 24 * time.Hour
+	tests := []struct {
+		in            HSTSArgs
+		want, wantErr string
+	}{
+		{HSTSArgs{}, "max-age=0", ""},
+		{HSTSArgs{MaxAge: time.Hour + 500*time.Millisecond}, "max-age=3600", ""},
+		{HSTSArgs{MaxAge: year, IncludeSubdomains: true}, "max-age=31536000; includeSubDomains", ""},
+		{HSTSArgs{MaxAge: year, IncludeSubdomains: true, Preload: true}, "max-age=31536000; includeSubDomains; preload", ""},
+		{HSTSArgs{MaxAge: year, Preload: true}, "", "Preload field requires"},
+		{HSTSArgs{MaxAge: time.Hour, IncludeSubdomains: true, Preload: true}, "", "Preload field requires"},
+		{HSTSArgs{MaxAge: -1}, "", "negative"},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			h := http.Header{}
+			err := SetHSTS(h, tt.in)
+			if !test.ErrorContains(err, tt.wantErr) {
+				t.Fatalf("wrong error\nout:  %v\nwant: %v", err, tt.wantErr)
+			}
+			if out := h.Get("Strict-Transport-Security"); out != tt.want {
+				t.Errorf("\nout:  %#v\nwant: %#v\n", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetPermissionsPolicy(t *testing.T) {
+	tests := []struct {
+		in            PermissionsPolicyArgs
+		want, wantErr string
+	}{
+		{PermissionsPolicyArgs{}, "", ""},
+		{PermissionsPolicyArgs{{"camera"}}, "camera=()", ""},
+		{PermissionsPolicyArgs{{"fullscreen", PermissionsStar}}, "fullscreen=*", ""},
+		{
+			PermissionsPolicyArgs{{"camera"}, {"geolocation", PermissionsSelf, "https://a.com"}},
+			`camera=(), geolocation=(self "https://a.com")`, "",
+		},
+		{PermissionsPolicyArgs{{}}, "", "mandatory"},
+		{PermissionsPolicyArgs{{"a b"}}, "", "invalid feature name"},
+		{PermissionsPolicyArgs{{"camera", `"x`}}, "", "invalid origin"},
+		{PermissionsPolicyArgs{{"camera", PermissionsSelf, PermissionsStar}}, "", "invalid origin"},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			h := http.Header{}
+			err := SetPermissionsPolicy(h, tt.in)
+			if !test.ErrorContains(err, tt.wantErr) {
+				t.Fatalf("wrong error\nout:  %v\nwant: %v", err, tt.wantErr)
+			}
+			if out := h.Get("Permissions-Policy"); out != tt.want {
+				t.Errorf("\nout:  %#v\nwant: %#v\n", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetEnum(t *testing.T) {
+	tests := []struct {
+		set          func(http.Header, string) error
+		in           string
+		key, wantErr string
+	}{
+		{SetReferrerPolicy, ReferrerPolicyNoReferrer, "Referrer-Policy", ""},
+		{SetReferrerPolicy, "never", "Referrer-Policy", `invalid Referrer-Policy value "never"`},
+		{SetCrossOriginOpenerPolicy, COOPSameOrigin, "Cross-Origin-Opener-Policy", ""},
+		{SetCrossOriginOpenerPolicy, "x", "Cross-Origin-Opener-Policy", "invalid"},
+		{SetCrossOriginEmbedderPolicy, COEPCredentialless, "Cross-Origin-Embedder-Policy", ""},
+		{SetCrossOriginEmbedderPolicy, "x", "Cross-Origin-Embedder-Policy", "invalid"},
+		{SetCrossOriginResourcePolicy, CORPCrossOrigin, "Cross-Origin-Resource-Policy", ""},
+		{SetCrossOriginResourcePolicy, "x", "Cross-Origin-Resource-Policy", "invalid"},
+		{SetFrameOptions, FrameOptionsSameOrigin, "X-Frame-Options", ""},
+		{SetFrameOptions, "ALLOW-FROM a.com", "X-Frame-Options", "invalid"},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			h := http.Header{}
+			err := tt.set(h, tt.in)
+			if !test.ErrorContains(err, tt.wantErr) {
+				t.Fatalf("wrong error\nout:  %v\nwant: %v", err, tt.wantErr)
+			}
+			want := tt.in
+			if tt.wantErr != "" {
+				want = ""
+			}
+			if out := h.Get(tt.key); out != want {
+				t.Errorf("\nout:  %#v\nwant: %#v\n", out, want)
+			}
+		})
+	}
+
+	if err := SetFrameOptions(nil, FrameOptionsDeny); !test.ErrorContains(err, "nil map") {
+		t.Errorf("wrong error: %v", err)
+	}
+}
+
+func TestSecurityHeadersMiddleware(t *testing.T) {
+	s := DefaultSecurityHeaders()
+	s.CSP = NewCSP(CSPArgs{{CSPDefaultSrc, CSPSourceSelf}})
+	h := SecurityHeadersMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Frame-Options", FrameOptionsSameOrigin)
+	}), s)
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	want := http.Header{
+		"Strict-Transport-Security":    {"max-age=63072000; includeSubDomains"},
+		"X-Content-Type-Options":       {"nosniff"},
+		"Referrer-Policy":              {"strict-origin-when-cross-origin"},
+		"Permissions-Policy":           {"camera=(), microphone=(), geolocation=()"},
+		"Cross-Origin-Opener-Policy":   {"same-origin"},
+		"Cross-Origin-Resource-Policy": {"same-origin"},
+		"X-Frame-Options":              {"SAMEORIGIN"},
+		"Content-Security-Policy":      {"default-src 'self'"},
+	}
+	if d := diff.Diff(fmt.Sprint(want), fmt.Sprint(rr.Header())); d != "" {
+		t.Error(d)
+	}
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("no panic for invalid headers")
+		}
+	}()
+	SecurityHeadersMiddleware(h, SecurityHeaders{FrameOptions: "x"})
+}
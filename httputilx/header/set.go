@@ -100,17 +100,22 @@ func formatFilename(s string) (string, string, bool) {
 // CSP Directives.
 const (
 	// Fetch directives
-	CSPChildSrc    = "child-src"    // Web workers and nested contexts such as frames
-	CSPConnectSrc  = "connect-src"  // Script interfaces: Ajax, WebSocket, Fetch API, etc
-	CSPDefaultSrc  = "default-src"  // Fallback for the other directives
-	CSPFontSrc     = "font-src"     // Custom fonts
-	CSPFrameSrc    = "frame-src"    // <frame> and <iframe>
-	CSPImgSrc      = "img-src"      // Images (HTML and CSS), favicon
-	CSPManifestSrc = "manifest-src" // Web app manifest
-	CSPMediaSrc    = "media-src"    // <audio> and <video>
-	CSPObjectSrc   = "object-src"   // <object>, <embed>, and <applet>
-	CSPScriptSrc   = "script-src"   // JavaScript
-	CSPStyleSrc    = "style-src"    // CSS
+	CSPChildSrc      = "child-src"       // Web workers and nested contexts such as frames
+	CSPConnectSrc    = "connect-src"     // Script interfaces: Ajax, WebSocket, Fetch API, etc
+	CSPDefaultSrc    = "default-src"     // Fallback for the other directives
+	CSPFontSrc       = "font-src"        // Custom fonts
+	CSPFrameSrc      = "frame-src"       // <frame> and <iframe>
+	CSPImgSrc        = "img-src"         // Images (HTML and CSS), favicon
+	CSPManifestSrc   = "manifest-src"    // Web app manifest
+	CSPMediaSrc      = "media-src"       // <audio> and <video>
+	CSPObjectSrc     = "object-src"      // <object>, <embed>, and <applet>
+	CSPScriptSrc     = "script-src"      // JavaScript
+	CSPScriptSrcElem = "script-src-elem" // <script> elements; falls back to script-src
+	CSPScriptSrcAttr = "script-src-attr" // Inline event handlers; falls back to script-src
+	CSPStyleSrc      = "style-src"       // CSS
+	CSPStyleSrcElem  = "style-src-elem"  // <style> and <link rel="stylesheet">; falls back to style-src
+	CSPStyleSrcAttr  = "style-src-attr"  // Inline style="" attributes; falls back to style-src
+	CSPWorkerSrc     = "worker-src"      // Worker, SharedWorker, and ServiceWorker
 
 	// Document directives govern the properties of a document
 	CSPBaseURI     = "base-uri"     // Restrict what can be used in <base>
@@ -124,18 +129,27 @@ const (
 	// Reporting directives control the reporting process of CSP violations; see
 	// also the Content-Security-Policy-Report-Only header
 	CSPReportURI = "report-uri"
+	CSPReportTo  = "report-to" // Name of a Reporting-Endpoints group; replaces report-uri
 
 	// Other directives
-	CSPBlockAllMixedContent = "block-all-mixed-content" // Don't load any HTTP content when using https
+	CSPBlockAllMixedContent    = "block-all-mixed-content"   // Don't load any HTTP content when using https
+	CSPUpgradeInsecureRequests = "upgrade-insecure-requests" // Load HTTP URLs over https
 )
 
 // Content-Security-Policy values
 const (
-	CSPSourceSelf         = "'self'"          // Exact origin of the document
-	CSPSourceNone         = "'none'"          // Nothing matches
-	CSPSourceUnsafeInline = "'unsafe-inline'" // Inline <script>/<style>, onevent="", etc.
-	CSPSourceUnsaleEval   = "'unsafe-eval'"   // eval()
-	CSPSourceStar         = "*"               // Everything
+	CSPSourceSelf           = "'self'"             // Exact origin of the document
+	CSPSourceNone           = "'none'"             // Nothing matches
+	CSPSourceUnsafeInline   = "'unsafe-inline'"    // Inline <script>/<style>, onevent="", etc.
+	CSPSourceUnsafeEval     = "'unsafe-eval'"      // eval()
+	CSPSourceUnsafeHashes   = "'unsafe-hashes'"    // Event handlers matching a hash source
+	CSPSourceWasmUnsafeEval = "'wasm-unsafe-eval'" // WebAssembly compilation
+	CSPSourceStrictDynamic  = "'strict-dynamic'"   // Trust scripts loaded by nonce or hash sources
+	CSPSourceReportSample   = "'report-sample'"    // Include a sample of the code in reports
+	CSPSourceStar           = "*"                  // Everything
+
+	// Deprecated: misspelled; use CSPSourceUnsafeEval.
+	CSPSourceUnsaleEval = CSPSourceUnsafeEval
 )
 
 // CSPArgs are arguments for SetCSP().
@@ -143,8 +157,8 @@ type CSPArgs [][]string
 
 // SetCSP sets a Content-Security-Policy header.
 //
-// Most directives require a value. The exceptions are CSPSandbox and
-// CSPBlockAllMixedContent.
+// Most directives require a value. The exceptions are CSPSandbox,
+// CSPUpgradeInsecureRequests, and CSPBlockAllMixedContent.
 //
 // Only special values (CSPSource* constants) need to be quoted. Don't add
 // quotes around hosts.
@@ -160,6 +174,17 @@ type CSPArgs [][]string
 // Also see: https://developer.mozilla.org/en-US/docs/Web/HTTP/CSP and
 // https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Content-Security-Policy
 func SetCSP(header http.Header, args CSPArgs) error {
+	return setCSP(header, "Content-Security-Policy", args)
+}
+
+// SetCSPReportOnly sets a Content-Security-Policy-Report-Only header, which
+// reports violations to the CSPReportURI or CSPReportTo without enforcing the
+// policy. See SetCSP.
+func SetCSPReportOnly(header http.Header, args CSPArgs) error {
+	return setCSP(header, "Content-Security-Policy-Report-Only", args)
+}
+
+func setCSP(header http.Header, key string, args CSPArgs) error {
 	if header == nil {
 		return errors.New("header is nil map")
 	}
@@ -167,12 +192,14 @@ func SetCSP(header http.Header, args CSPArgs) error {
 	var b strings.Builder
 	i := 1
 	for _, v := range args {
-		if len(v) < 2 {
+		if len(v) < 2 && (len(v) == 0 || !cspNoValue(v[0])) {
 			return errors.New("expected pair of values")
 		}
 
 		b.WriteString(v[0])
-		b.WriteString(" ")
+		if len(v) > 1 {
+			b.WriteString(" ")
+		}
 
 		for j := range v[1:] {
 			b.WriteString(v[j+1])
@@ -187,6 +214,15 @@ func SetCSP(header http.Header, args CSPArgs) error {
 		i++
 	}
 
-	header["Content-Security-Policy"] = []string{b.String()}
+	header[key] = []string{b.String()}
 	return nil
 }
+
+// cspNoValue reports if the directive can be used without a value.
+func cspNoValue(directive string) bool {
+	switch directive {
+	case CSPSandbox, CSPUpgradeInsecureRequests, CSPBlockAllMixedContent:
+		return true
+	}
+	return false
+}
@@ -88,3 +88,26 @@ func TestCSP(t *testing.T) {
 		})
 	}
 }
+
+func TestCSPReportOnly(t *testing.T) {
+	header := make(http.Header)
+	err := SetCSPReportOnly(header, CSPArgs{
+		{CSPDefaultSrc, CSPSourceSelf},
+		{CSPUpgradeInsecureRequests},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "default-src 'self'; upgrade-insecure-requests"
+	if out := header.Get("Content-Security-Policy-Report-Only"); out != want {
+		t.Errorf("\nout:  %#v\nwant: %#v\n", out, want)
+	}
+	if _, ok := header["Content-Security-Policy"]; ok {
+		t.Error("Content-Security-Policy is set")
+	}
+
+	err = SetCSPReportOnly(header, CSPArgs{{CSPScriptSrc}})
+	if !test.ErrorContains(err, "expected pair of values") {
+		t.Errorf("wrong error: %v", err)
+	}
+}
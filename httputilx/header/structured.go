@@ -0,0 +1,643 @@
+package header
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Structured field values, as defined in RFC 8941.
+//
+// Bare item values are one of these types:
+//
+//	Integer        int64 (int is also accepted when serializing)
+//	Decimal        float64
+//	String         string
+//	Token          SFToken
+//	Byte Sequence  []byte
+//	Boolean        bool
+//
+// https://www.rfc-editor.org/rfc/rfc8941
+
+// SFToken is a token bare item, as opposed to a string.
+type SFToken string
+
+// SFParam is a parameter of an item or inner list.
+type SFParam struct {
+	Key   string
+	Value any // Bare item.
+}
+
+// SFParams are parameters; they're ordered and keys are unique.
+type SFParams []SFParam
+
+// Get a parameter value.
+func (p SFParams) Get(key string) (any, bool) {
+	for _, pp := range p {
+		if pp.Key == key {
+			return pp.Value, true
+		}
+	}
+	return nil, false
+}
+
+func (p *SFParams) set(key string, v any) {
+	for i := range *p {
+		if (*p)[i].Key == key {
+			(*p)[i].Value = v
+			return
+		}
+	}
+	*p = append(*p, SFParam{Key: key, Value: v})
+}
+
+// SFMember is a member of a list or dictionary: either an SFItem or an
+// SFInnerList.
+type SFMember interface {
+	sfMember()
+}
+
+// SFItem is an item: a bare item with parameters.
+type SFItem struct {
+	Value  any // Bare item.
+	Params SFParams
+}
+
+// SFInnerList is an inner list of items with parameters.
+type SFInnerList struct {
+	Items  []SFItem
+	Params SFParams
+}
+
+func (SFItem) sfMember()      {}
+func (SFInnerList) sfMember() {}
+
+// SFList is a list.
+type SFList []SFMember
+
+// SFDictMember is a member of a dictionary.
+type SFDictMember struct {
+	Key    string
+	Member SFMember
+}
+
+// SFDictionary is a dictionary; it's ordered and keys are unique.
+type SFDictionary []SFDictMember
+
+// Get a dictionary member.
+func (d SFDictionary) Get(key string) (SFMember, bool) {
+	for _, m := range d {
+		if m.Key == key {
+			return m.Member, true
+		}
+	}
+	return nil, false
+}
+
+// ParseSFItem parses the header as a structured item.
+func ParseSFItem(header http.Header, key string) (SFItem, error) {
+	v, ok := header[http.CanonicalHeaderKey(key)]
+	if !ok {
+		return SFItem{}, fmt.Errorf("header %v not present", key)
+	}
+	p := sfParser{s: strings.Join(v, ", ")}
+	var item SFItem
+	err := p.top(func() (err error) {
+		item, err = p.item()
+		return err
+	})
+	return item, err
+}
+
+// ParseSFList parses the header as a structured list. Multiple headers are
+// combined in to one list. The list is empty if the header is not present.
+func ParseSFList(header http.Header, key string) (SFList, error) {
+	p := sfParser{s: strings.Join(header.Values(key), ", ")}
+	var list SFList
+	err := p.top(func() error {
+		return p.members(func() error {
+			m, err := p.itemOrInnerList()
+			if err != nil {
+				return err
+			}
+			list = append(list, m)
+			return nil
+		})
+	})
+	return list, err
+}
+
+// ParseSFDictionary parses the header as a structured dictionary. Multiple
+// headers are combined in to one dictionary. The dictionary is empty if the
+// header is not present.
+func ParseSFDictionary(header http.Header, key string) (SFDictionary, error) {
+	p := sfParser{s: strings.Join(header.Values(key), ", ")}
+	var dict SFDictionary
+	err := p.top(func() error {
+		return p.members(func() error {
+			k, err := p.key()
+			if err != nil {
+				return err
+			}
+
+			var m SFMember
+			if p.consume('=') {
+				m, err = p.itemOrInnerList()
+			} else {
+				var params SFParams
+				params, err = p.params()
+				m = SFItem{Value: true, Params: params}
+			}
+			if err != nil {
+				return err
+			}
+
+			for i := range dict {
+				if dict[i].Key == k {
+					dict[i].Member = m
+					return nil
+				}
+			}
+			dict = append(dict, SFDictMember{Key: k, Member: m})
+			return nil
+		})
+	})
+	return dict, err
+}
+
+// SetSFItem sets the header to a structured item. Any previous value will be
+// overwritten.
+func SetSFItem(header http.Header, key string, item SFItem) error {
+	return setSF(header, key, func(b *strings.Builder) error { return writeSFItem(b, item) })
+}
+
+// SetSFList sets the header to a structured list. Any previous value will be
+// overwritten, and the header is removed if the list is empty.
+func SetSFList(header http.Header, key string, list SFList) error {
+	return setSF(header, key, func(b *strings.Builder) error {
+		for i, m := range list {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			if err := writeSFMember(b, m); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SetSFDictionary sets the header to a structured dictionary. Any previous
+// value will be overwritten, and the header is removed if the dictionary is
+// empty.
+func SetSFDictionary(header http.Header, key string, dict SFDictionary) error {
+	return setSF(header, key, func(b *strings.Builder) error {
+		for i, m := range dict {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			if err := writeSFKey(b, m.Key); err != nil {
+				return err
+			}
+			if item, ok := m.Member.(SFItem); ok && item.Value == true {
+				if err := writeSFParams(b, item.Params); err != nil {
+					return err
+				}
+				continue
+			}
+			b.WriteByte('=')
+			if err := writeSFMember(b, m.Member); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func setSF(header http.Header, key string, write func(*strings.Builder) error) error {
+	if header == nil {
+		return errors.New("header is nil map")
+	}
+	var b strings.Builder
+	if err := write(&b); err != nil {
+		return err
+	}
+	if b.Len() == 0 {
+		header.Del(key)
+		return nil
+	}
+	header.Set(key, b.String())
+	return nil
+}
+
+func writeSFMember(b *strings.Builder, m SFMember) error {
+	switch mm := m.(type) {
+	case SFItem:
+		return writeSFItem(b, mm)
+	case SFInnerList:
+		b.WriteByte('(')
+		for i, item := range mm.Items {
+			if i > 0 {
+				b.WriteByte(' ')
+			}
+			if err := writeSFItem(b, item); err != nil {
+				return err
+			}
+		}
+		b.WriteByte(')')
+		return writeSFParams(b, mm.Params)
+	default:
+		return fmt.Errorf("invalid member type %T", m)
+	}
+}
+
+func writeSFItem(b *strings.Builder, item SFItem) error {
+	if err := writeSFBareItem(b, item.Value); err != nil {
+		return err
+	}
+	return writeSFParams(b, item.Params)
+}
+
+func writeSFParams(b *strings.Builder, params SFParams) error {
+	for _, p := range params {
+		b.WriteByte(';')
+		if err := writeSFKey(b, p.Key); err != nil {
+			return err
+		}
+		if p.Value != true {
+			b.WriteByte('=')
+			if err := writeSFBareItem(b, p.Value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func writeSFKey(b *strings.Builder, key string) error {
+	for i := 0; i < len(key); i++ {
+		if !isSFKeyChar(key[i], i == 0) {
+			return fmt.Errorf("invalid key %q", key)
+		}
+	}
+	if key == "" {
+		return errors.New("empty key")
+	}
+	b.WriteString(key)
+	return nil
+}
+
+// Integers and decimals are limited to 15 and 12.3 digits.
+const (
+	sfMaxInt     = 999_999_999_999_999
+	sfMaxDecimal = 999_999_999_999
+)
+
+func writeSFBareItem(b *strings.Builder, v any) error {
+	switch vv := v.(type) {
+	case int:
+		return writeSFBareItem(b, int64(vv))
+	case int64:
+		if vv > sfMaxInt || vv < -sfMaxInt {
+			return fmt.Errorf("integer %d out of range", vv)
+		}
+		b.WriteString(strconv.FormatInt(vv, 10))
+	case float64:
+		r := math.RoundToEven(vv*1000) / 1000
+		if math.IsNaN(r) || math.Abs(r) >= sfMaxDecimal+1 {
+			return fmt.Errorf("decimal %v out of range", vv)
+		}
+		s := strconv.FormatFloat(r, 'f', -1, 64)
+		if !strings.Contains(s, ".") {
+			s += ".0"
+		}
+		b.WriteString(s)
+	case string:
+		b.WriteByte('"')
+		for i := 0; i < len(vv); i++ {
+			c := vv[i]
+			if c < 0x20 || c > 0x7e {
+				return fmt.Errorf("invalid character %q in string", c)
+			}
+			if c == '"' || c == '\\' {
+				b.WriteByte('\\')
+			}
+			b.WriteByte(c)
+		}
+		b.WriteByte('"')
+	case SFToken:
+		if vv == "" {
+			return errors.New("empty token")
+		}
+		for i := 0; i < len(vv); i++ {
+			if !isSFTokenChar(vv[i], i == 0) {
+				return fmt.Errorf("invalid token %q", vv)
+			}
+		}
+		b.WriteString(string(vv))
+	case []byte:
+		b.WriteByte(':')
+		b.WriteString(base64.StdEncoding.EncodeToString(vv))
+		b.WriteByte(':')
+	case bool:
+		if vv {
+			b.WriteString("?1")
+		} else {
+			b.WriteString("?0")
+		}
+	default:
+		return fmt.Errorf("invalid bare item type %T", v)
+	}
+	return nil
+}
+
+func isSFKeyChar(c byte, first bool) bool {
+	if c >= 'a' && c <= 'z' || c == '*' {
+		return true
+	}
+	return !first && (c >= '0' && c <= '9' || c == '_' || c == '-' || c == '.')
+}
+
+func isSFTokenChar(c byte, first bool) bool {
+	if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '*' {
+		return true
+	}
+	return !first && (octetTypes[c]&isToken != 0 || c == ':' || c == '/')
+}
+
+type sfParser struct {
+	s string
+	i int
+}
+
+func (p *sfParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("invalid structured field at offset %d: %s", p.i, fmt.Sprintf(format, args...))
+}
+
+func (p *sfParser) eof() bool { return p.i >= len(p.s) }
+
+func (p *sfParser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.s[p.i]
+}
+
+func (p *sfParser) consume(c byte) bool {
+	if !p.eof() && p.s[p.i] == c {
+		p.i++
+		return true
+	}
+	return false
+}
+
+func (p *sfParser) skipSP() {
+	for p.consume(' ') {
+	}
+}
+
+func (p *sfParser) skipOWS() {
+	for p.consume(' ') || p.consume('\t') {
+	}
+}
+
+func (p *sfParser) top(parse func() error) error {
+	p.skipSP()
+	if err := parse(); err != nil {
+		return err
+	}
+	p.skipSP()
+	if !p.eof() {
+		return p.errorf("unexpected %q", p.peek())
+	}
+	return nil
+}
+
+// members parses comma-separated list or dictionary members.
+func (p *sfParser) members(member func() error) error {
+	for !p.eof() {
+		if err := member(); err != nil {
+			return err
+		}
+		p.skipOWS()
+		if p.eof() {
+			return nil
+		}
+		if !p.consume(',') {
+			return p.errorf("expected ','")
+		}
+		p.skipOWS()
+		if p.eof() {
+			return p.errorf("trailing ','")
+		}
+	}
+	return nil
+}
+
+func (p *sfParser) itemOrInnerList() (SFMember, error) {
+	if p.peek() == '(' {
+		return p.innerList()
+	}
+	return p.item()
+}
+
+func (p *sfParser) innerList() (SFInnerList, error) {
+	var l SFInnerList
+	p.consume('(')
+	for !p.eof() {
+		p.skipSP()
+		if p.consume(')') {
+			var err error
+			l.Params, err = p.params()
+			return l, err
+		}
+		item, err := p.item()
+		if err != nil {
+			return l, err
+		}
+		l.Items = append(l.Items, item)
+		if c := p.peek(); !p.eof() && c != ' ' && c != ')' {
+			return l, p.errorf("expected ' ' or ')' in inner list")
+		}
+	}
+	return l, p.errorf("unterminated inner list")
+}
+
+func (p *sfParser) item() (SFItem, error) {
+	v, err := p.bareItem()
+	if err != nil {
+		return SFItem{}, err
+	}
+	params, err := p.params()
+	return SFItem{Value: v, Params: params}, err
+}
+
+func (p *sfParser) params() (SFParams, error) {
+	var params SFParams
+	for p.consume(';') {
+		p.skipSP()
+		k, err := p.key()
+		if err != nil {
+			return nil, err
+		}
+		var v any = true
+		if p.consume('=') {
+			if v, err = p.bareItem(); err != nil {
+				return nil, err
+			}
+		}
+		params.set(k, v)
+	}
+	return params, nil
+}
+
+func (p *sfParser) key() (string, error) {
+	start := p.i
+	if p.eof() || !isSFKeyChar(p.s[p.i], true) {
+		return "", p.errorf("expected key")
+	}
+	for !p.eof() && isSFKeyChar(p.s[p.i], false) {
+		p.i++
+	}
+	return p.s[start:p.i], nil
+}
+
+func (p *sfParser) bareItem() (any, error) {
+	c := p.peek()
+	switch {
+	case p.eof():
+		return nil, p.errorf("expected item")
+	case c == '-' || c >= '0' && c <= '9':
+		return p.number()
+	case c == '"':
+		return p.string()
+	case c == ':':
+		return p.byteSequence()
+	case c == '?':
+		return p.boolean()
+	case isSFTokenChar(c, true):
+		return p.token(), nil
+	default:
+		return nil, p.errorf("unexpected %q", c)
+	}
+}
+
+func (p *sfParser) number() (any, error) {
+	start := p.i
+	p.consume('-')
+	if c := p.peek(); c < '0' || c > '9' {
+		return nil, p.errorf("expected digit")
+	}
+
+	// The length excludes the sign, but includes the dot.
+	digits := p.i
+	dot := -1
+	for !p.eof() {
+		c := p.s[p.i]
+		if c == '.' && dot < 0 {
+			if p.i-digits > 12 {
+				return nil, p.errorf("decimal too long")
+			}
+			dot = p.i
+		} else if c < '0' || c > '9' {
+			break
+		}
+		p.i++
+		if dot < 0 && p.i-digits > 15 {
+			return nil, p.errorf("integer too long")
+		}
+		if dot >= 0 && p.i-digits > 16 {
+			return nil, p.errorf("decimal too long")
+		}
+	}
+
+	num := p.s[start:p.i]
+	if dot < 0 {
+		n, err := strconv.ParseInt(num, 10, 64)
+		if err != nil {
+			return nil, p.errorf("%v", err)
+		}
+		return n, nil
+	}
+	if frac := p.i - dot - 1; frac == 0 || frac > 3 {
+		return nil, p.errorf("decimal must have 1 to 3 fractional digits")
+	}
+	f, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return nil, p.errorf("%v", err)
+	}
+	return f, nil
+}
+
+func (p *sfParser) string() (string, error) {
+	p.consume('"')
+	var b strings.Builder
+	for !p.eof() {
+		c := p.s[p.i]
+		p.i++
+		switch {
+		case c == '\\':
+			if e := p.peek(); e != '"' && e != '\\' {
+				return "", p.errorf("invalid escape in string")
+			}
+			b.WriteByte(p.s[p.i])
+			p.i++
+		case c == '"':
+			return b.String(), nil
+		case c < 0x20 || c > 0x7e:
+			return "", p.errorf("invalid character %q in string", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+func (p *sfParser) token() SFToken {
+	start := p.i
+	p.i++
+	for !p.eof() && isSFTokenChar(p.s[p.i], false) {
+		p.i++
+	}
+	return SFToken(p.s[start:p.i])
+}
+
+func (p *sfParser) byteSequence() ([]byte, error) {
+	p.consume(':')
+	end := strings.IndexByte(p.s[p.i:], ':')
+	if end < 0 {
+		return nil, p.errorf("unterminated byte sequence")
+	}
+	enc := p.s[p.i : p.i+end]
+	for i := 0; i < len(enc); i++ {
+		c := enc[i]
+		if !(c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '+' || c == '/' || c == '=') {
+			return nil, p.errorf("invalid character %q in byte sequence", c)
+		}
+	}
+	b, err := base64.StdEncoding.DecodeString(enc)
+	if err != nil {
+		// Padding is optional.
+		if b, err = base64.RawStdEncoding.DecodeString(enc); err != nil {
+			return nil, p.errorf("invalid byte sequence: %v", err)
+		}
+	}
+	p.i += end + 1
+	return b, nil
+}
+
+func (p *sfParser) boolean() (bool, error) {
+	p.consume('?')
+	switch {
+	case p.consume('1'):
+		return true, nil
+	case p.consume('0'):
+		return false, nil
+	default:
+		return false, p.errorf("invalid boolean")
+	}
+}
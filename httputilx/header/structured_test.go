@@ -0,0 +1,202 @@
+package header
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/teamwork/test"
+)
+
+func TestParseSFItem(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    any    // Bare item
+		out     string // Serialized; defaults to in.
+		wantErr string
+	}{
+		{"42", int64(42), "", ""},
+		{"-42", int64(-42), "", ""},
+		{"042", int64(42), "42", ""},
+		{"999999999999999", int64(999999999999999), "", ""},
+		{"1000000000000000", nil, "", "integer too long"},
+		{"-999999999999999", int64(-999999999999999), "", ""},
+		{"1.5", 1.5, "", ""},
+		{"-0.125", -0.125, "", ""},
+		{"1.50", 1.5, "1.5", ""},
+		{"999999999999.999", 999999999999.999, "", ""},
+		{"1000000000000.0", nil, "", "decimal too long"},
+		{"1.", nil, "", "fractional digits"},
+		{"1.1234", nil, "", "fractional digits"},
+		{"-", nil, "", "expected digit"},
+		{`"hello world"`, "hello world", "", ""},
+		{`"a \"b\" \\c"`, `a "b" \c`, "", ""},
+		{`"\a"`, nil, "", "invalid escape"},
+		{`"é"`, nil, "", "invalid character"},
+		{`"open`, nil, "", "unterminated string"},
+		{"foo123/456", SFToken("foo123/456"), "", ""},
+		{"*foo:bar!", SFToken("*foo:bar!"), "", ""},
+		{":aGVsbG8=:", []byte("hello"), "", ""},
+		{":aGVsbG8:", []byte("hello"), ":aGVsbG8=:", ""},
+		{"::", []byte{}, "", ""},
+		{":aGVs*G8=:", nil, "", "invalid character"},
+		{":aGVsbG8=", nil, "", "unterminated byte sequence"},
+		{"?1", true, "", ""},
+		{"?0", false, "", ""},
+		{"?2", nil, "", "invalid boolean"},
+		{"  42  ", int64(42), "42", ""},
+		{"42 43", nil, "", "unexpected"},
+		{"", nil, "", "expected item"},
+		{"@", nil, "", "unexpected"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			item, err := ParseSFItem(http.Header{"Test": {tt.in}}, "Test")
+			if !test.ErrorContains(err, tt.wantErr) {
+				t.Fatalf("wrong error\nout:  %v\nwant: %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(item.Value, tt.want) {
+				t.Errorf("\nout:  %#v\nwant: %#v\n", item.Value, tt.want)
+			}
+
+			want := tt.out
+			if want == "" {
+				want = tt.in
+			}
+			h := http.Header{}
+			if err := SetSFItem(h, "Test", item); err != nil {
+				t.Fatal(err)
+			}
+			if out := h.Get("Test"); out != want {
+				t.Errorf("\nout:  %#v\nwant: %#v\n", out, want)
+			}
+		})
+	}
+
+	if _, err := ParseSFItem(http.Header{}, "Test"); !test.ErrorContains(err, "not present") {
+		t.Errorf("wrong error: %v", err)
+	}
+}
+
+func TestParseSFList(t *testing.T) {
+	tests := []struct {
+		in      []string
+		out     string // Defaults to in[0].
+		wantErr string
+	}{
+		{nil, "", ""},
+		{[]string{"sugar, tea, rum"}, "", ""},
+		{[]string{"sugar,tea,\trum"}, "sugar, tea, rum", ""},
+		{[]string{"sugar, tea", "rum"}, "sugar, tea, rum", ""},
+		{[]string{`("foo" "bar"), ("baz"), ("bat" "one"), ()`}, "", ""},
+		{[]string{`("foo"; a=1;b=2);lvl=5, ("bar" "baz");lvl=1`}, `("foo";a=1;b=2);lvl=5, ("bar" "baz");lvl=1`, ""},
+		{[]string{`abc;a=1;b=2; cde_456, (ghi;jk=4 l);q="9";r=w`}, `abc;a=1;b=2;cde_456, (ghi;jk=4 l);q="9";r=w`, ""},
+		{[]string{"a;x=1;x=2"}, "a;x=2", ""},
+		{[]string{"( a  b )"}, "(a b)", ""},
+		{[]string{"a,"}, "", "trailing ','"},
+		{[]string{"a b"}, "", "expected ','"},
+		{[]string{"(a,b)"}, "", "expected ' ' or ')'"},
+		{[]string{"(a b"}, "", "unterminated inner list"},
+		{[]string{"a;A=1"}, "", "expected key"},
+	}
+
+	for _, tt := range tests {
+		t.Run("", func(t *testing.T) {
+			h := http.Header{}
+			for _, v := range tt.in {
+				h.Add("Test", v)
+			}
+			list, err := ParseSFList(h, "Test")
+			if !test.ErrorContains(err, tt.wantErr) {
+				t.Fatalf("wrong error\nout:  %v\nwant: %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			want := tt.out
+			if want == "" && len(tt.in) > 0 {
+				want = tt.in[0]
+			}
+			h = http.Header{}
+			if err := SetSFList(h, "Test", list); err != nil {
+				t.Fatal(err)
+			}
+			if out := h.Get("Test"); out != want {
+				t.Errorf("\nout:  %#v\nwant: %#v\n", out, want)
+			}
+		})
+	}
+}
+
+func TestParseSFDictionary(t *testing.T) {
+	h := http.Header{"Test": {`en="Applepie", da=:w4ZibGV0w6ZydGU=:`, "a=?0, b, c;foo=bar, a=(1 2);x"}}
+	dict, err := ParseSFDictionary(h, "Test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `en="Applepie", da=:w4ZibGV0w6ZydGU=:, a=(1 2);x, b, c;foo=bar`
+	h = http.Header{}
+	if err := SetSFDictionary(h, "Test", dict); err != nil {
+		t.Fatal(err)
+	}
+	if out := h.Get("Test"); out != want {
+		t.Errorf("\nout:  %#v\nwant: %#v\n", out, want)
+	}
+
+	m, ok := dict.Get("c")
+	if !ok {
+		t.Fatal("c not found")
+	}
+	if v, _ := m.(SFItem).Params.Get("foo"); v != SFToken("bar") {
+		t.Errorf("wrong param: %#v", v)
+	}
+	if m, _ := dict.Get("a"); len(m.(SFInnerList).Items) != 2 {
+		t.Errorf("wrong member: %#v", m)
+	}
+
+	for _, in := range []string{"a=", "A=1", "a=1,", "a=1 b=2"} {
+		if _, err := ParseSFDictionary(http.Header{"Test": {in}}, "Test"); err == nil {
+			t.Errorf("no error for %q", in)
+		}
+	}
+}
+
+func TestSetSFErrors(t *testing.T) {
+	tests := []struct {
+		item    SFItem
+		wantErr string
+	}{
+		{SFItem{Value: 1_000_000_000_000_000}, "out of range"},
+		{SFItem{Value: 1e12}, "out of range"},
+		{SFItem{Value: "é"}, "invalid character"},
+		{SFItem{Value: SFToken("1a")}, "invalid token"},
+		{SFItem{Value: SFToken("")}, "empty token"},
+		{SFItem{Value: uint8(1)}, "invalid bare item type"},
+		{SFItem{Value: 1, Params: SFParams{{Key: "A", Value: 1}}}, "invalid key"},
+		{SFItem{Value: 1, Params: SFParams{{Key: "", Value: 1}}}, "empty key"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.wantErr, func(t *testing.T) {
+			err := SetSFItem(http.Header{}, "Test", tt.item)
+			if !test.ErrorContains(err, tt.wantErr) {
+				t.Errorf("wrong error\nout:  %v\nwant: %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	// Rounded to 3 decimals, half to even.
+	h := http.Header{}
+	if err := SetSFList(h, "Test", SFList{SFItem{Value: 1.0}, SFItem{Value: 0.0025}, SFItem{Value: 2.3456}}); err != nil {
+		t.Fatal(err)
+	}
+	if out, want := h.Get("Test"), "1.0, 0.002, 2.346"; out != want {
+		t.Errorf("\nout:  %#v\nwant: %#v\n", out, want)
+	}
+}
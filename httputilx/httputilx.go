@@ -2,17 +2,22 @@
 package httputilx // import "github.com/teamwork/utils/v2/httputilx"
 
 import (
+	"bufio"
 	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"net/http/httputil"
-	"os"
-	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/andybalholm/brotli"
 	"github.com/pkg/errors"
 	"github.com/teamwork/utils/v2/ioutilx"
 )
@@ -64,99 +69,230 @@ func DumpBody(r *http.Request, maxSize int64) ([]byte, error) {
 	return b.Bytes(), nil
 }
 
-// ErrNotOK is used when the status code is not 200 OK.
+// DumpResponseBody reads the body of a HTTP response without consuming it, so
+// it can be read again later.
+// It will read at most maxSize of bytes. Use -1 to read everything.
+//
+// The body is decompressed according to the Content-Encoding header; gzip,
+// deflate, and br are supported. The resp.Body is left as-is.
+func DumpResponseBody(resp *http.Response, maxSize int64) ([]byte, error) {
+	if resp.Body == nil {
+		return nil, nil
+	}
+
+	save, body, err := ioutilx.DumpReader(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = save
+
+	var r io.Reader = body
+	encodings := resp.Header.Values("Content-Encoding")
+	for i := len(encodings) - 1; i >= 0; i-- {
+		parts := strings.Split(encodings[i], ",")
+		for j := len(parts) - 1; j >= 0; j-- {
+			r, err = decodeContent(r, strings.TrimSpace(parts[j]))
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var b bytes.Buffer
+	if maxSize < 0 {
+		_, err = io.Copy(&b, r)
+	} else {
+		_, err = io.CopyN(&b, r, maxSize)
+		if err == io.EOF {
+			err = nil
+		}
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot decode response body")
+	}
+	return b.Bytes(), nil
+}
+
+func decodeContent(r io.Reader, encoding string) (io.Reader, error) {
+	switch strings.ToLower(encoding) {
+	case "", "identity":
+		return r, nil
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot decode response body")
+		}
+		return zr, nil
+	case "deflate":
+		// "deflate" should be zlib, but some servers send raw DEFLATE data.
+		br := bufio.NewReader(r)
+		if h, err := br.Peek(2); err == nil && h[0]&0x0f == 8 && (uint(h[0])<<8|uint(h[1]))%31 == 0 {
+			zr, err := zlib.NewReader(br)
+			if err != nil {
+				return nil, errors.Wrap(err, "cannot decode response body")
+			}
+			return zr, nil
+		}
+		return flate.NewReader(br), nil
+	case "br":
+		return brotli.NewReader(r), nil
+	default:
+		return nil, errors.Errorf("unsupported Content-Encoding %q", encoding)
+	}
+}
+
+// ErrNotOK is used when the status code is not 200 OK, or not one of the
+// accepted status codes for FetchContext.
 type ErrNotOK struct {
 	URL string
 	Err string
+
+	StatusCode int
+	Header     http.Header
+	Body       []byte // At most the first 1K of the body.
 }
 
 func (e ErrNotOK) Error() string {
 	return fmt.Sprintf("code %v while downloading %v", e.Err, e.URL)
 }
 
+// maxErrorBody is the maximum size of ErrNotOK.Body.
+const maxErrorBody = 1024
+
+func newErrNotOK(url string, response *http.Response, body []byte) ErrNotOK {
+	if len(body) > maxErrorBody {
+		body = body[:maxErrorBody]
+	}
+	return ErrNotOK{
+		URL:        url,
+		Err:        fmt.Sprintf("%v %v", response.StatusCode, response.Status),
+		StatusCode: response.StatusCode,
+		Header:     response.Header,
+		Body:       body,
+	}
+}
+
 // Fetch the contents of an HTTP URL.
 //
 // This is not intended to cover all possible use cases  for fetching files,
 // only the most common ones. Use the net/http package for more advanced usage.
 func Fetch(url string) ([]byte, error) {
-	client := http.Client{Timeout: 60 * time.Second}
-	response, err := client.Get(url)
-	if err != nil {
-		return nil, errors.Wrapf(err, "cannot download %v", url)
-	}
-	defer response.Body.Close() // nolint: errcheck
+	return FetchContext(context.Background(), url)
+}
 
-	// TODO: Maybe add sanity check to bail out of the Content-Length is very
-	// large?
-	data, err := io.ReadAll(response.Body)
-	if err != nil {
-		return nil, errors.Wrapf(err, "cannot read body of %v", url)
+type fetchOptions struct {
+	client  *http.Client
+	maxSize int64
+	status  []int
+}
+
+// FetchOption is a function that configures FetchContext.
+type FetchOption func(*fetchOptions)
+
+// FetchWithClient sets the HTTP client to be used. By default, a client with a
+// 60s timeout is used.
+func FetchWithClient(client *http.Client) FetchOption {
+	return func(o *fetchOptions) {
+		o.client = client
 	}
+}
 
-	if response.StatusCode != http.StatusOK {
-		return data, ErrNotOK{
-			URL: url,
-			Err: fmt.Sprintf("%v %v", response.StatusCode, response.Status),
-		}
+// FetchWithMaxSize sets the maximum size of the body in bytes; an error
+// wrapping ErrTooLarge is returned if it's larger. By default, there is no
+// limit.
+func FetchWithMaxSize(maxSize int64) FetchOption {
+	return func(o *fetchOptions) {
+		o.maxSize = maxSize
 	}
+}
 
-	return data, nil
+// FetchWithStatus sets the accepted status codes; ErrNotOK is returned for any
+// other status code. By default, only 200 is accepted.
+func FetchWithStatus(codes ...int) FetchOption {
+	return func(o *fetchOptions) {
+		o.status = codes
+	}
 }
 
-// Save an HTTP URL to the directory dir with the filename. The filename can be
-// generated from the URL if empty.
+// FetchContext fetches the contents of an HTTP URL, like Fetch.
 //
-// It will return the full path to the save file. Note that it may create both a
-// file *and* return an error (e.g. in cases of non-200 status codes).
+// The body is returned even if the status code is not accepted, in which case
+// the error is ErrNotOK, which can be inspected with errors.As:
 //
-// This is not intended to cover all possible use cases  for fetching files,
-// only the most common ones. Use the net/http package for more advanced usage.
-func Save(url string, dir string, filename string) (string, error) {
-	// Use last path of url if filename is empty
-	if filename == "" {
-		tokens := strings.Split(url, "/")
-		filename = tokens[len(tokens)-1]
+//	var notOK httputilx.ErrNotOK
+//	if errors.As(err, &notOK) && notOK.StatusCode == http.StatusNotFound {
+//	    // ...
+//	}
+func FetchContext(ctx context.Context, url string, options ...FetchOption) ([]byte, error) {
+	o := fetchOptions{
+		client: &http.Client{Timeout: 60 * time.Second},
+		status: []int{http.StatusOK},
+	}
+	for _, option := range options {
+		option(&o)
 	}
-	path := filepath.FromSlash(dir + "/" + filename)
 
-	client := http.Client{Timeout: 60 * time.Second}
-	response, err := client.Get(url)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot download %v", url)
+	}
+	response, err := o.client.Do(req)
 	if err != nil {
-		return "", errors.Wrapf(err, "cannot download %v", url)
+		return nil, errors.Wrapf(err, "cannot download %v", url)
 	}
 	defer response.Body.Close() // nolint: errcheck
 
-	output, err := os.Create(path)
-	if err != nil {
-		return "", errors.Wrapf(err, "cannot create %v", path)
+	if o.maxSize > 0 && response.ContentLength > o.maxSize {
+		return nil, errors.Wrapf(ErrTooLarge, "cannot download %v: size %d exceeds %d",
+			url, response.ContentLength, o.maxSize)
 	}
-	defer output.Close() // nolint: errcheck
 
-	_, err = io.Copy(output, response.Body)
+	body := io.Reader(response.Body)
+	if o.maxSize > 0 {
+		body = io.LimitReader(body, o.maxSize+1)
+	}
+	data, err := io.ReadAll(body)
 	if err != nil {
-		return path, errors.Wrapf(err, "cannot read body of %v in to %v", url, path)
+		return nil, errors.Wrapf(err, "cannot read body of %v", url)
+	}
+	if o.maxSize > 0 && int64(len(data)) > o.maxSize {
+		return nil, errors.Wrapf(ErrTooLarge, "cannot download %v: size exceeds %d", url, o.maxSize)
 	}
 
-	if response.StatusCode != http.StatusOK {
-		return path, ErrNotOK{
-			URL: url,
-			Err: fmt.Sprintf("%v %v", response.StatusCode, response.Status),
-		}
+	if !slices.Contains(o.status, response.StatusCode) {
+		return data, newErrNotOK(url, response, data)
 	}
 
-	return path, nil
+	return data, nil
+}
+
+// Save an HTTP URL to the directory dir with the filename. The filename can be
+// generated from the URL if empty.
+//
+// It will return the full path to the save file. Note that it may create both a
+// file *and* return an error (e.g. in cases of non-200 status codes), unless
+// SaveWithAtomic is used.
+//
+// The download times out after 60s unless a different client is set with
+// SaveWithClient.
+//
+// This is not intended to cover all possible use cases  for fetching files,
+// only the most common ones. Use the net/http package for more advanced usage.
+func Save(url string, dir string, filename string, options ...SaveOption) (string, error) {
+	options = append([]SaveOption{SaveWithClient(&http.Client{Timeout: 60 * time.Second})}, options...)
+	return SaveContext(context.Background(), url, dir, filename, options...)
 }
 
 // ExponentialBackoffOptions contains options for the exponential backoff retry
 // mechanism.
 type ExponentialBackoffOptions struct {
-	client            *http.Client
-	maxRetries        int
-	initialBackoff    time.Duration
-	maxBackoff        time.Duration
-	backoffMultiplier float64
-	shouldRetry       func(resp *http.Response, err error) bool
-	logger            *slog.Logger
+	client        *http.Client
+	maxRetries    int
+	policy        BackoffPolicy
+	maxRetryAfter time.Duration
+	maxElapsed    time.Duration
+	shouldRetry   func(resp *http.Response, err error) bool
+	logger        *slog.Logger
 }
 
 // ExponentialBackoffOption is a function that configures
@@ -174,6 +310,8 @@ func ExponentialBackoffWithClient(client *http.Client) ExponentialBackoffOption
 // ExponentialBackoffWithConfig sets the configuration for the exponential
 // backoff retry mechanism. By default, it will retry up to 3 times, starting
 // with a 100ms backoff, doubling each time up to a maximum of 5s.
+//
+// This sets the policy to ExponentialPolicy.
 func ExponentialBackoffWithConfig(
 	maxRetries int,
 	initialBackoff, maxBackoff time.Duration,
@@ -181,9 +319,43 @@ func ExponentialBackoffWithConfig(
 ) ExponentialBackoffOption {
 	return func(o *ExponentialBackoffOptions) {
 		o.maxRetries = maxRetries
-		o.initialBackoff = initialBackoff
-		o.maxBackoff = maxBackoff
-		o.backoffMultiplier = backoffMultiplier
+		o.policy = ExponentialPolicy(initialBackoff, maxBackoff, backoffMultiplier)
+	}
+}
+
+// ExponentialBackoffWithMaxRetries sets the maximum number of retries. By
+// default, it will retry up to 3 times.
+func ExponentialBackoffWithMaxRetries(maxRetries int) ExponentialBackoffOption {
+	return func(o *ExponentialBackoffOptions) {
+		o.maxRetries = maxRetries
+	}
+}
+
+// ExponentialBackoffWithPolicy sets the policy to determine how long to wait
+// between retries. By default, ExponentialPolicy is used with the values from
+// ExponentialBackoffWithConfig.
+func ExponentialBackoffWithPolicy(policy BackoffPolicy) ExponentialBackoffOption {
+	return func(o *ExponentialBackoffOptions) {
+		o.policy = policy
+	}
+}
+
+// ExponentialBackoffWithMaxRetryAfter sets the maximum time to wait when the
+// server sends a Retry-After header on a 429 or 503 response. If the server
+// asks to wait longer the response is returned without retrying. By default,
+// this is 1 minute. Use 0 to ignore the Retry-After header.
+func ExponentialBackoffWithMaxRetryAfter(maxRetryAfter time.Duration) ExponentialBackoffOption {
+	return func(o *ExponentialBackoffOptions) {
+		o.maxRetryAfter = maxRetryAfter
+	}
+}
+
+// ExponentialBackoffWithMaxElapsed sets the total time budget for all attempts.
+// No retry is attempted if waiting for it would exceed this time, in which case
+// the last response is returned. By default, there is no limit.
+func ExponentialBackoffWithMaxElapsed(maxElapsed time.Duration) ExponentialBackoffOption {
+	return func(o *ExponentialBackoffOptions) {
+		o.maxElapsed = maxElapsed
 	}
 }
 
@@ -208,29 +380,50 @@ func ExponentialBackoffWithLogger(logger *slog.Logger) ExponentialBackoffOption
 
 // DoExponentialBackoff will send an API request using exponential backoff until
 // it either succeeds or the maximum number of retries is reached.
+//
+// It stops waiting as soon as the request's context is cancelled, in which case
+// the context's error is returned.
 func DoExponentialBackoff(req *http.Request, options ...ExponentialBackoffOption) (*http.Response, error) {
+	o := newExponentialBackoffOptions(options)
+	return o.do(req, o.client.Do)
+}
+
+func newExponentialBackoffOptions(options []ExponentialBackoffOption) ExponentialBackoffOptions {
 	o := ExponentialBackoffOptions{
-		client:            http.DefaultClient,
-		maxRetries:        3,
-		initialBackoff:    100 * time.Millisecond,
-		maxBackoff:        5 * time.Second,
-		backoffMultiplier: 2.0,
-		shouldRetry: func(resp *http.Response, err error) bool {
-			if err != nil {
-				return true
-			}
-			if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
-				return true
-			}
-			return false
-		},
-		logger: slog.New(slog.DiscardHandler),
+		client:        http.DefaultClient,
+		maxRetries:    3,
+		policy:        ExponentialPolicy(100*time.Millisecond, 5*time.Second, 2.0),
+		maxRetryAfter: time.Minute,
+		shouldRetry:   defaultShouldRetry,
+		logger:        slog.New(slog.DiscardHandler),
 	}
 	for _, option := range options {
 		option(&o)
 	}
+	return o
+}
+
+// defaultShouldRetry retries on any error, as well as on HTTP 5xx and 429
+// status codes.
+func defaultShouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return true
+	}
+	return false
+}
 
-	backoff := o.initialBackoff
+// do sends the request with send until it either succeeds or the maximum number
+// of retries is reached.
+func (o ExponentialBackoffOptions) do(
+	req *http.Request,
+	send func(*http.Request) (*http.Response, error),
+) (*http.Response, error) {
+	ctx := req.Context()
+	start := time.Now()
+	var backoff time.Duration
 
 	for attempt := 0; attempt <= o.maxRetries; attempt++ {
 		reqClone, err := cloneWithBody(req)
@@ -238,8 +431,27 @@ func DoExponentialBackoff(req *http.Request, options ...ExponentialBackoffOption
 			return nil, errors.Wrap(err, "failed to clone request with body")
 		}
 
-		resp, err := o.client.Do(reqClone)
-		if !o.shouldRetry(resp, err) || attempt >= o.maxRetries {
+		resp, err := send(reqClone)
+		if !o.shouldRetry(resp, err) || attempt >= o.maxRetries || ctx.Err() != nil {
+			return resp, err
+		}
+
+		backoff = o.policy.Backoff(attempt+1, backoff)
+		if o.maxRetryAfter > 0 {
+			if wait, ok := retryAfter(resp, time.Now()); ok {
+				if wait > o.maxRetryAfter {
+					o.logger.Debug("Retry-After exceeds maximum; not retrying",
+						slog.Int("attempt", attempt+1),
+						slog.Duration("retry_after", wait))
+					return resp, err
+				}
+				backoff = max(backoff, wait)
+			}
+		}
+		if o.maxElapsed > 0 && time.Since(start)+backoff > o.maxElapsed {
+			o.logger.Debug("maximum elapsed time reached; not retrying",
+				slog.Int("attempt", attempt+1),
+				slog.Duration("backoff", backoff))
 			return resp, err
 		}
 
@@ -261,8 +473,14 @@ func DoExponentialBackoff(req *http.Request, options ...ExponentialBackoffOption
 		}
 
 		o.logger.Debug("request failed", logArgs...)
-		time.Sleep(backoff)
-		backoff = min(time.Duration(float64(backoff)*o.backoffMultiplier), o.maxBackoff)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
 	}
 
 	return nil, fmt.Errorf("request failed after %d attempts", o.maxRetries+1)
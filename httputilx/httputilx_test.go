@@ -6,6 +6,11 @@ package httputilx
 
 import (
 	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -16,6 +21,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/andybalholm/brotli"
 	"github.com/teamwork/test"
 )
 
@@ -195,6 +201,77 @@ func TestDumpBody(t *testing.T) {
 	}
 }
 
+func TestDumpResponseBody(t *testing.T) {
+	content := strings.Repeat("Hello, world! ", 100)
+	compress := func(enc string) []byte {
+		var b bytes.Buffer
+		var w io.WriteCloser
+		switch enc {
+		case "gzip":
+			w = gzip.NewWriter(&b)
+		case "deflate":
+			w, _ = flate.NewWriter(&b, flate.DefaultCompression)
+		case "zlib":
+			w = zlib.NewWriter(&b)
+		case "br":
+			w = brotli.NewWriter(&b)
+		default:
+			return []byte(content)
+		}
+		_, _ = io.WriteString(w, content)
+		_ = w.Close()
+		return b.Bytes()
+	}
+
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+		maxSize  int64
+		want     string
+		wantErr  string
+	}{
+		{"identity", "", compress(""), -1, content, ""},
+		{"maxSize", "", compress(""), 5, "Hello", ""},
+		{"gzip", "gzip", compress("gzip"), -1, content, ""},
+		{"gzip maxSize", "gzip", compress("gzip"), 5, "Hello", ""},
+		{"deflate zlib", "deflate", compress("zlib"), -1, content, ""},
+		{"deflate raw", "deflate", compress("deflate"), -1, content, ""},
+		{"br", "BR", compress("br"), -1, content, ""},
+		{"unknown", "compress", compress(""), -1, "", `unsupported Content-Encoding "compress"`},
+		{"invalid gzip", "gzip", compress(""), -1, "", "gzip: invalid header"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{
+				Header: http.Header{},
+				Body:   io.NopCloser(bytes.NewReader(tt.body)),
+			}
+			if tt.encoding != "" {
+				resp.Header.Set("Content-Encoding", tt.encoding)
+			}
+
+			got, err := DumpResponseBody(resp, tt.maxSize)
+			if !test.ErrorContains(err, tt.wantErr) {
+				t.Fatalf("wrong error\nout:  %v\nwant: %v", err, tt.wantErr)
+			}
+			if string(got) != tt.want {
+				t.Errorf("\nwant: %q\ngot:  %q", tt.want, got)
+			}
+
+			body, _ := io.ReadAll(resp.Body)
+			if !bytes.Equal(body, tt.body) {
+				t.Error("body was modified")
+			}
+		})
+	}
+
+	if got, err := DumpResponseBody(&http.Response{}, -1); err != nil || got != nil {
+		t.Errorf("nil body: %v, %v", got, err)
+	}
+}
+
 func chunk(s string) string {
 	return fmt.Sprintf("%x\r\n%s\r\n", len(s), s)
 }
@@ -225,6 +302,72 @@ func TestFetch(t *testing.T) {
 	}
 }
 
+func TestFetchContext(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/teapot":
+			w.Header().Set("X-Reason", "short and stout")
+			w.WriteHeader(http.StatusTeapot)
+			_, _ = w.Write([]byte(strings.Repeat("teapot", 1000)))
+		case "/created":
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte("created"))
+		case "/chunked":
+			_, _ = w.Write([]byte(strings.Repeat("x", 50)))
+			w.(http.Flusher).Flush()
+			_, _ = w.Write([]byte(strings.Repeat("x", 100)))
+		default:
+			_, _ = w.Write([]byte(strings.Repeat("x", 100)))
+		}
+	}))
+	defer ts.Close()
+
+	cases := []struct {
+		path     string
+		options  []FetchOption
+		want     string
+		wantErr  string
+		wantCode int
+	}{
+		{"/", nil, strings.Repeat("x", 100), "", 0},
+		{"/", []FetchOption{FetchWithMaxSize(100)}, strings.Repeat("x", 100), "", 0},
+		{"/", []FetchOption{FetchWithMaxSize(99)}, "", "too large", 0},
+		{"/chunked", []FetchOption{FetchWithMaxSize(100)}, "", "too large", 0},
+		{"/created", nil, "created", "201", http.StatusCreated},
+		{"/created", []FetchOption{FetchWithStatus(http.StatusOK, http.StatusCreated)}, "created", "", 0},
+		{"/teapot", []FetchOption{FetchWithClient(&http.Client{})}, strings.Repeat("teapot", 1000), "418", http.StatusTeapot},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.path, func(t *testing.T) {
+			out, err := FetchContext(context.Background(), ts.URL+tc.path, tc.options...)
+			if !test.ErrorContains(err, tc.wantErr) {
+				t.Fatalf("wrong error\nout:  %#v\nwant: %#v\n", err, tc.wantErr)
+			}
+			if string(out) != tc.want {
+				t.Errorf("\nout:  %#v\nwant: %#v\n", string(out), tc.want)
+			}
+
+			var notOK ErrNotOK
+			if errors.As(err, &notOK) != (tc.wantCode != 0) {
+				t.Fatalf("wrong error type: %T", err)
+			}
+			if tc.wantCode == 0 {
+				return
+			}
+			if notOK.StatusCode != tc.wantCode {
+				t.Errorf("wrong status code: %d", notOK.StatusCode)
+			}
+			if len(notOK.Body) > 1024 || !strings.HasPrefix(tc.want, string(notOK.Body)) {
+				t.Errorf("wrong body: %q", notOK.Body)
+			}
+			if tc.wantCode == http.StatusTeapot && notOK.Header.Get("X-Reason") != "short and stout" {
+				t.Errorf("wrong header: %v", notOK.Header)
+			}
+		})
+	}
+}
+
 func TestDoExponentialBackoff(t *testing.T) {
 	tests := []struct {
 		name         string
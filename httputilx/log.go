@@ -0,0 +1,367 @@
+package httputilx
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type logOptions struct {
+	logger        *slog.Logger
+	level         slog.Level
+	maxBody       int64
+	redactHeaders []string
+	redactFields  []string
+	sampleRate    float64
+}
+
+// LogOption is a function that configures LogMiddleware and LogTransport.
+type LogOption func(*logOptions)
+
+// LogWithLogger sets the logger. By default, slog.Default() is used.
+func LogWithLogger(logger *slog.Logger) LogOption {
+	return func(o *logOptions) {
+		o.logger = logger
+	}
+}
+
+// LogWithLevel sets the level to log requests at. By default, slog.LevelInfo
+// is used.
+func LogWithLevel(level slog.Level) LogOption {
+	return func(o *logOptions) {
+		o.level = level
+	}
+}
+
+// LogWithMaxBody sets the maximum number of bytes of the request and response
+// bodies to log. Use 0 to not log bodies. By default, this is 1K.
+func LogWithMaxBody(maxBody int64) LogOption {
+	return func(o *logOptions) {
+		o.maxBody = maxBody
+	}
+}
+
+// LogWithRedactHeaders sets the request and response headers to redact. By
+// default, Authorization, Proxy-Authorization, Cookie, and Set-Cookie are
+// redacted.
+func LogWithRedactHeaders(headers ...string) LogOption {
+	return func(o *logOptions) {
+		o.redactHeaders = headers
+	}
+}
+
+// LogWithRedactFields sets the JSON object keys to redact in request and
+// response bodies, at any depth. Keys are matched case-insensitive.
+//
+// Bodies which can't be parsed as JSON (e.g. because they're truncated) are not
+// logged if this is set. By default, no fields are redacted.
+func LogWithRedactFields(fields ...string) LogOption {
+	return func(o *logOptions) {
+		o.redactFields = fields
+	}
+}
+
+// LogWithSampleRate sets the fraction of requests to log, between 0 and 1.
+// Requests that fail with an error or a 5xx status code are always logged, but
+// without the request body if they weren't sampled. By default, all requests
+// are logged.
+func LogWithSampleRate(rate float64) LogOption {
+	return func(o *logOptions) {
+		o.sampleRate = rate
+	}
+}
+
+func newLogOptions(options []LogOption) logOptions {
+	o := logOptions{
+		logger:        slog.Default(),
+		level:         slog.LevelInfo,
+		maxBody:       1024,
+		redactHeaders: []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"},
+		sampleRate:    1,
+	}
+	for _, option := range options {
+		option(&o)
+	}
+	return o
+}
+
+// LogMiddleware logs every request to the handler with the method, URL, status
+// code, latency, headers, and the start of the request and response bodies.
+//
+// The bodies are recorded as they're read and written, so only the part of the
+// request body that the handler reads is logged.
+func LogMiddleware(next http.Handler, options ...LogOption) http.Handler {
+	o := newLogOptions(options)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sampled := o.sample()
+		var reqBody *logBody
+		if sampled && o.maxBody > 0 && r.Body != nil && r.Body != http.NoBody {
+			reqBody = &logBody{ReadCloser: r.Body, maxBody: o.maxBody}
+			r.Body = reqBody
+		}
+
+		rec := &logResponseWriter{ResponseWriter: w, maxBody: o.maxBody}
+		start := time.Now()
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		o.log(r.Context(), "http request", sampled, r, reqBody.Bytes(), rec.status, rec.Header(), rec.body.Bytes(), time.Since(start), nil)
+	})
+}
+
+// LogTransport is a http.RoundTripper which logs every request like
+// LogMiddleware.
+//
+// The response body is recorded as it's read, and the request is logged once
+// the response body is read to the end or closed. The latency is the time until
+// the response headers were received.
+type LogTransport struct {
+	next    http.RoundTripper
+	options logOptions
+}
+
+var _ http.RoundTripper = &LogTransport{}
+
+// NewLogTransport creates a new LogTransport which sends requests with next, or
+// http.DefaultTransport if nil.
+func NewLogTransport(next http.RoundTripper, options ...LogOption) *LogTransport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &LogTransport{next: next, options: newLogOptions(options)}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *LogTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	o := t.options
+	sampled := o.sample()
+
+	var reqBody *logBody
+	if sampled && o.maxBody > 0 && req.Body != nil && req.Body != http.NoBody {
+		// A RoundTripper must not modify the request.
+		req = req.Clone(req.Context())
+		reqBody = &logBody{ReadCloser: req.Body, maxBody: o.maxBody}
+		req.Body = reqBody
+	}
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	latency := time.Since(start)
+	if err != nil {
+		o.log(req.Context(), "http client request", sampled, req, reqBody.Bytes(), 0, nil, nil, latency, err)
+		return resp, err
+	}
+
+	if !sampled || o.maxBody <= 0 {
+		o.log(req.Context(), "http client request", sampled, req, reqBody.Bytes(), resp.StatusCode, resp.Header, nil, latency, nil)
+		return resp, nil
+	}
+
+	respBody := &logBody{ReadCloser: resp.Body, maxBody: o.maxBody}
+	respBody.done = func() {
+		o.log(req.Context(), "http client request", sampled, req, reqBody.Bytes(), resp.StatusCode, resp.Header, respBody.Bytes(), latency, nil)
+	}
+	resp.Body = respBody
+	return resp, nil
+}
+
+// logBody records the first maxBody bytes read from the body. The done
+// function, if set, is called once on EOF, a read error, or Close.
+type logBody struct {
+	io.ReadCloser
+	maxBody int64
+	done    func()
+
+	mu   sync.Mutex
+	buf  bytes.Buffer
+	once sync.Once
+}
+
+func (b *logBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.mu.Lock()
+	if rem := b.maxBody - int64(b.buf.Len()); rem > 0 {
+		b.buf.Write(p[:min(int64(n), rem)])
+	}
+	b.mu.Unlock()
+	if err != nil {
+		b.finish()
+	}
+	return n, err
+}
+
+func (b *logBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.finish()
+	return err
+}
+
+func (b *logBody) finish() {
+	if b.done != nil {
+		b.once.Do(b.done)
+	}
+}
+
+// Bytes returns a copy of what was recorded so far; it's safe to call on a nil
+// logBody.
+func (b *logBody) Bytes() []byte {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return bytes.Clone(b.buf.Bytes())
+}
+
+// sample reports if a request should be logged according to the sample rate.
+func (o logOptions) sample() bool {
+	return o.sampleRate >= 1 || rand.Float64() < o.sampleRate
+}
+
+func (o logOptions) log(
+	ctx context.Context, msg string, sampled bool,
+	r *http.Request, reqBody []byte,
+	status int, respHeader http.Header, respBody []byte,
+	latency time.Duration, err error,
+) {
+	failed := err != nil || status >= 500
+	if !failed && !sampled {
+		return
+	}
+	level := o.level
+	if failed {
+		level = max(level, slog.LevelError)
+	}
+	if !o.logger.Enabled(ctx, level) {
+		return
+	}
+
+	attrs := []slog.Attr{
+		slog.String("method", r.Method),
+		slog.String("url", r.URL.String()),
+		slog.Duration("latency", latency),
+		o.headerAttr("request_header", r.Header),
+	}
+	if o.maxBody > 0 {
+		attrs = append(attrs, slog.String("request_body", o.body(r.Header, reqBody)))
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	} else {
+		attrs = append(attrs,
+			slog.Int("status", status),
+			o.headerAttr("response_header", respHeader))
+		if o.maxBody > 0 {
+			attrs = append(attrs, slog.String("response_body", o.body(respHeader, respBody)))
+		}
+	}
+	o.logger.LogAttrs(ctx, level, msg, attrs...)
+}
+
+func (o logOptions) headerAttr(key string, h http.Header) slog.Attr {
+	attrs := make([]any, 0, len(h))
+	for k, v := range h {
+		val := strings.Join(v, ", ")
+		for _, r := range o.redactHeaders {
+			if strings.EqualFold(k, r) {
+				val = "REDACTED"
+				break
+			}
+		}
+		attrs = append(attrs, slog.String(k, val))
+	}
+	return slog.Group(key, attrs...)
+}
+
+// body gets the body to log, with the JSON fields redacted.
+func (o logOptions) body(h http.Header, body []byte) string {
+	if len(o.redactFields) == 0 || len(body) == 0 {
+		return string(body)
+	}
+
+	ct, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	if ct != "" && ct != "application/json" && !strings.HasSuffix(ct, "+json") {
+		return string(body)
+	}
+
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		return "[body omitted: cannot redact]"
+	}
+	v = redactJSON(v, o.redactFields)
+	out, err := json.Marshal(v)
+	if err != nil {
+		return "[body omitted: cannot redact]"
+	}
+	return string(out)
+}
+
+func redactJSON(v any, fields []string) any {
+	switch vv := v.(type) {
+	case map[string]any:
+		for k, val := range vv {
+			redact := false
+			for _, f := range fields {
+				if strings.EqualFold(k, f) {
+					redact = true
+					break
+				}
+			}
+			if redact {
+				vv[k] = "REDACTED"
+			} else {
+				vv[k] = redactJSON(val, fields)
+			}
+		}
+	case []any:
+		for i := range vv {
+			vv[i] = redactJSON(vv[i], fields)
+		}
+	}
+	return v
+}
+
+type logResponseWriter struct {
+	http.ResponseWriter
+	status  int
+	maxBody int64
+	body    bytes.Buffer
+}
+
+func (w *logResponseWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *logResponseWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if rem := w.maxBody - int64(w.body.Len()); rem > 0 {
+		w.body.Write(p[:min(int64(len(p)), rem)])
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Unwrap is used by http.ResponseController.
+func (w *logResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *logResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,225 @@
+package httputilx
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func testLogger() (*slog.Logger, *bytes.Buffer) {
+	buf := new(bytes.Buffer)
+	return slog.New(slog.NewJSONHandler(buf, nil)), buf
+}
+
+func TestLogMiddleware(t *testing.T) {
+	logger, buf := testLogger()
+	h := LogMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Set-Cookie", "session=secret")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"token":"secret","echo":` + string(body) + `}`))
+	}), LogWithLogger(logger), LogWithRedactFields("password", "token"))
+
+	req := httptest.NewRequest(http.MethodPost, "/x?a=b", strings.NewReader(`{"user":"a","password":"secret"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer secret")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusCreated {
+		t.Errorf("wrong status: %d", rr.Code)
+	}
+	if !strings.Contains(rr.Body.String(), `"password":"secret"`) {
+		t.Errorf("request body not passed to handler: %s", rr.Body.String())
+	}
+
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("%v: %s", err, buf.String())
+	}
+	if strings.Contains(buf.String(), "secret") {
+		t.Errorf("not redacted:\n%s", buf.String())
+	}
+	if line["method"] != "POST" || line["url"] != "/x?a=b" || line["status"] != float64(201) {
+		t.Errorf("wrong log line: %s", buf.String())
+	}
+	if !strings.Contains(line["response_body"].(string), `"token":"REDACTED"`) {
+		t.Errorf("wrong response body: %v", line["response_body"])
+	}
+}
+
+func TestLogTransport(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/500" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		_, _ = io.Copy(w, r.Body)
+	}))
+	defer ts.Close()
+
+	t.Run("body", func(t *testing.T) {
+		logger, buf := testLogger()
+		client := &http.Client{Transport: NewLogTransport(nil, LogWithLogger(logger), LogWithMaxBody(5))}
+		resp, err := client.Post(ts.URL, "text/plain", strings.NewReader("0123456789"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close() // nolint: errcheck
+		body, _ := io.ReadAll(resp.Body)
+		if string(body) != "0123456789" {
+			t.Errorf("wrong body: %q", body)
+		}
+
+		var line map[string]any
+		if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+			t.Fatalf("%v: %s", err, buf.String())
+		}
+		if line["request_body"] != "01234" || line["response_body"] != "01234" {
+			t.Errorf("wrong log line: %s", buf.String())
+		}
+	})
+
+	t.Run("sample", func(t *testing.T) {
+		logger, buf := testLogger()
+		client := &http.Client{Transport: NewLogTransport(nil, LogWithLogger(logger), LogWithSampleRate(0))}
+		for _, path := range []string{"/", "/500"} {
+			resp, err := client.Get(ts.URL + path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = resp.Body.Close()
+		}
+		if n := strings.Count(buf.String(), "\n"); n != 1 || !strings.Contains(buf.String(), `"level":"ERROR"`) {
+			t.Errorf("wrong log:\n%s", buf.String())
+		}
+	})
+}
+
+type countReader struct {
+	r      io.Reader
+	n      int
+	closed bool
+}
+
+func (c *countReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
+
+func (c *countReader) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestLogMiddlewareBody(t *testing.T) {
+	logger, buf := testLogger()
+	body := &countReader{r: strings.NewReader(strings.Repeat("x", 1<<20))}
+	h := LogMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if body.n > 0 {
+			t.Errorf("read %d bytes before handler", body.n)
+		}
+		b, _ := io.ReadAll(r.Body)
+		if len(b) != 1<<20 {
+			t.Errorf("wrong body length: %d", len(b))
+		}
+	}), LogWithLogger(logger), LogWithMaxBody(5))
+
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if !strings.Contains(buf.String(), `"request_body":"xxxxx"`) {
+		t.Errorf("wrong log:\n%s", buf.String())
+	}
+
+	t.Run("sampled out", func(t *testing.T) {
+		body := &countReader{r: strings.NewReader("abc")}
+		h := LogMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if body.n > 0 {
+				t.Errorf("read %d bytes before handler", body.n)
+			}
+		}), LogWithLogger(logger), LogWithSampleRate(0))
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", body))
+	})
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestLogTransportBodyError(t *testing.T) {
+	logger, buf := testLogger()
+	body := &countReader{r: iotest.ErrReader(errors.New("oh no"))}
+	tr := NewLogTransport(roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: body}, nil
+	}), LogWithLogger(logger))
+
+	resp, err := tr.RoundTrip(httptest.NewRequest(http.MethodGet, "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(resp.Body); err == nil || err.Error() != "oh no" {
+		t.Fatalf("wrong error: %v", err)
+	}
+	if n := strings.Count(buf.String(), "\n"); n != 1 {
+		t.Errorf("logged %d lines:\n%s", n, buf.String())
+	}
+	_ = resp.Body.Close()
+	if !body.closed {
+		t.Error("response body not closed")
+	}
+	if n := strings.Count(buf.String(), "\n"); n != 1 {
+		t.Errorf("logged %d lines:\n%s", n, buf.String())
+	}
+}
+
+func TestLogTransportStream(t *testing.T) {
+	done := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("first"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-done:
+		case <-time.After(10 * time.Second):
+		}
+		_, _ = w.Write([]byte("second"))
+	}))
+	defer ts.Close()
+
+	logger, buf := testLogger()
+	client := &http.Client{Transport: NewLogTransport(nil, LogWithLogger(logger))}
+	start := time.Now()
+	resp, err := client.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close() // nolint: errcheck
+
+	first := make([]byte, 5)
+	if _, err := io.ReadFull(resp.Body, first); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("first chunk took %s", d)
+	}
+	if buf.Len() > 0 {
+		t.Errorf("logged before the body was read:\n%s", buf.String())
+	}
+	close(done)
+
+	rest, _ := io.ReadAll(resp.Body)
+	if string(first)+string(rest) != "firstsecond" {
+		t.Errorf("wrong body: %q", string(first)+string(rest))
+	}
+	if !strings.Contains(buf.String(), `"response_body":"firstsecond"`) {
+		t.Errorf("wrong log:\n%s", buf.String())
+	}
+}
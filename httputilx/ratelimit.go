@@ -0,0 +1,218 @@
+package httputilx
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrRateLimitExhausted is returned by RateLimiter.Wait when there are no tokens
+// left and the rate is 0, so no more requests will ever be allowed.
+var ErrRateLimitExhausted = errors.New("rate limit exhausted")
+
+// RateLimiter limits the rate of outbound requests with a token bucket per
+// host, or per key from the function set with RateLimiterWithKey.
+//
+// It can be used as a http.RoundTripper with Transport, or standalone with
+// Wait.
+type RateLimiter struct {
+	rate     float64
+	burst    float64
+	key      func(*http.Request) string
+	adaptive bool
+	now      func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	until  time.Time // Don't allow any requests before this time.
+}
+
+// RateLimiterOption is a function that configures a RateLimiter.
+type RateLimiterOption func(*RateLimiter)
+
+// RateLimiterWithKey sets the function to get the key for a request; requests
+// with the same key share a token bucket. By default, the host of the request
+// URL is used.
+func RateLimiterWithKey(key func(*http.Request) string) RateLimiterOption {
+	return func(l *RateLimiter) {
+		l.key = key
+	}
+}
+
+// RateLimiterWithAdaptive makes the transport adapt the rate from the response
+// headers. By default, the headers are ignored.
+//
+// The Retry-After header on 429 and 503 responses blocks all requests until
+// that time. The X-RateLimit-Remaining header limits the available tokens, and
+// if it's 0 all requests are blocked until the time in X-RateLimit-Reset, which
+// can be either a Unix timestamp or a number of seconds.
+func RateLimiterWithAdaptive() RateLimiterOption {
+	return func(l *RateLimiter) {
+		l.adaptive = true
+	}
+}
+
+// NewRateLimiter creates a new rate limiter which allows rate requests per
+// second, with bursts of up to burst requests.
+//
+// A rate of 0 or less means the bucket never refills: only burst requests are
+// allowed per key, after which Wait returns ErrRateLimitExhausted.
+func NewRateLimiter(rate float64, burst int, options ...RateLimiterOption) *RateLimiter {
+	if !(rate > 0) { // Also catch NaN.
+		rate = 0
+	}
+	l := &RateLimiter{
+		rate:    rate,
+		burst:   float64(max(burst, 1)),
+		key:     func(r *http.Request) string { return r.URL.Host },
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+	}
+	for _, option := range options {
+		option(l)
+	}
+	return l
+}
+
+// Wait blocks until a request for key is allowed, or until the context is
+// cancelled, in which case the context's error is returned.
+//
+// ErrRateLimitExhausted is returned if the rate is 0 and all tokens are used.
+func (l *RateLimiter) Wait(ctx context.Context, key string) error {
+	for {
+		wait, err := l.take(key)
+		if err != nil {
+			return err
+		}
+		if wait <= 0 {
+			return nil
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Update the bucket for key from the response headers; this is done
+// automatically by Transport if RateLimiterWithAdaptive is set.
+func (l *RateLimiter) Update(key string, resp *http.Response) {
+	if resp == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	b := l.bucket(key, now)
+
+	if wait, ok := retryAfter(resp, now); ok {
+		b.until = later(b.until, now.Add(wait))
+	}
+
+	remaining, err := strconv.ParseFloat(strings.TrimSpace(resp.Header.Get("X-RateLimit-Remaining")), 64)
+	if err != nil || remaining < 0 {
+		return
+	}
+	b.tokens = min(b.tokens, remaining)
+	if remaining > 0 {
+		return
+	}
+	reset, err := strconv.ParseInt(strings.TrimSpace(resp.Header.Get("X-RateLimit-Reset")), 10, 64)
+	if err != nil || reset <= 0 {
+		return
+	}
+	// There's no standard, so guess: GitHub and others use a Unix timestamp,
+	// and some use the number of seconds.
+	if reset > 1_000_000_000 {
+		b.until = later(b.until, time.Unix(reset, 0))
+	} else {
+		b.until = later(b.until, now.Add(time.Duration(reset)*time.Second))
+	}
+}
+
+// Transport returns a http.RoundTripper which waits for the rate limiter before
+// sending requests with next, or http.DefaultTransport if nil.
+func (l *RateLimiter) Transport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &rateLimitTransport{limiter: l, next: next}
+}
+
+// take a token from the bucket, returning how long to wait if there are none.
+func (l *RateLimiter) take(key string) (time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	b := l.bucket(key, now)
+
+	if now.Before(b.until) {
+		return b.until.Sub(now), nil
+	}
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, nil
+	}
+	if l.rate == 0 {
+		return 0, ErrRateLimitExhausted
+	}
+	return max(time.Duration((1-b.tokens)/l.rate*float64(time.Second)), time.Millisecond), nil
+}
+
+// bucket gets the bucket for key and refills it.
+func (l *RateLimiter) bucket(key string, now time.Time) *bucket {
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+		return b
+	}
+
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = min(b.tokens+elapsed.Seconds()*l.rate, l.burst)
+		b.last = now
+	}
+	return b
+}
+
+func later(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+type rateLimitTransport struct {
+	limiter *RateLimiter
+	next    http.RoundTripper
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	key := t.limiter.key(req)
+	if err := t.limiter.Wait(req.Context(), key); err != nil {
+		if req.Body != nil {
+			_ = req.Body.Close()
+		}
+		return nil, err
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if t.limiter.adaptive {
+		t.limiter.Update(key, resp)
+	}
+	return resp, err
+}
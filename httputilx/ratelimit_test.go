@@ -0,0 +1,123 @@
+package httputilx
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := NewRateLimiter(2, 3)
+	l.now = func() time.Time { return now }
+
+	// Burst.
+	for i := 0; i < 3; i++ {
+		if wait, _ := l.take("a"); wait != 0 {
+			t.Fatalf("request %d: wait %v", i, wait)
+		}
+	}
+	if wait, _ := l.take("a"); wait != 500*time.Millisecond {
+		t.Fatalf("wrong wait: %v", wait)
+	}
+	if wait, _ := l.take("b"); wait != 0 {
+		t.Fatalf("other key: wait %v", wait)
+	}
+
+	// Refill.
+	now = now.Add(time.Second)
+	for i := 0; i < 2; i++ {
+		if wait, _ := l.take("a"); wait != 0 {
+			t.Fatalf("request %d: wait %v", i, wait)
+		}
+	}
+	if wait, _ := l.take("a"); wait == 0 {
+		t.Fatal("no wait")
+	}
+}
+
+func TestRateLimiterZeroRate(t *testing.T) {
+	for _, rate := range []float64{0, -1} {
+		l := NewRateLimiter(rate, 2)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		for i := 0; i < 2; i++ {
+			if err := l.Wait(ctx, "a"); err != nil {
+				t.Fatalf("rate %v, request %d: %v", rate, i, err)
+			}
+		}
+		if err := l.Wait(ctx, "a"); !errors.Is(err, ErrRateLimitExhausted) {
+			t.Errorf("rate %v: wrong error: %v", rate, err)
+		}
+		cancel()
+	}
+}
+
+func TestRateLimiterUpdate(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		code    int
+		headers map[string]string
+		want    time.Duration
+	}{
+		{"none", 200, nil, 0},
+		{"retry-after", 429, map[string]string{"Retry-After": "10"}, 10 * time.Second},
+		{"remaining", 200, map[string]string{"X-RateLimit-Remaining": "0"}, 500 * time.Millisecond},
+		{"reset seconds", 200, map[string]string{
+			"X-RateLimit-Remaining": "0",
+			"X-RateLimit-Reset":     "30",
+		}, 30 * time.Second},
+		{"reset timestamp", 200, map[string]string{
+			"X-RateLimit-Remaining": "0",
+			"X-RateLimit-Reset":     strconv.FormatInt(now.Add(time.Minute).Unix(), 10),
+		}, time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewRateLimiter(2, 3)
+			l.now = func() time.Time { return now }
+
+			resp := &http.Response{StatusCode: tt.code, Header: http.Header{}}
+			for k, v := range tt.headers {
+				resp.Header.Set(k, v)
+			}
+			l.Update("a", resp)
+
+			if wait, _ := l.take("a"); wait != tt.want {
+				t.Errorf("\nout:  %v\nwant: %v", wait, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimiterTransport(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer ts.Close()
+
+	client := &http.Client{Transport: NewRateLimiter(100, 1, RateLimiterWithAdaptive()).Transport(nil)}
+
+	resp, err := client.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.Do(req)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("wrong error: %v", err)
+	}
+}
@@ -0,0 +1,44 @@
+package httputilx
+
+import (
+	"net/http"
+)
+
+// RetryTransport is a http.RoundTripper which retries requests with the same
+// logic as DoExponentialBackoff, so that retries can be added to any
+// http.Client:
+//
+//	client := &http.Client{
+//	    Transport: httputilx.NewRetryTransport(nil,
+//	        httputilx.ExponentialBackoffWithPolicy(httputilx.FullJitterPolicy(...))),
+//	}
+type RetryTransport struct {
+	next    http.RoundTripper
+	options ExponentialBackoffOptions
+}
+
+var _ http.RoundTripper = &RetryTransport{}
+
+// NewRetryTransport creates a new RetryTransport which sends requests with next,
+// or http.DefaultTransport if nil.
+//
+// The options are the same as for DoExponentialBackoff; the client set with
+// ExponentialBackoffWithClient is ignored.
+func NewRetryTransport(next http.RoundTripper, options ...ExponentialBackoffOption) *RetryTransport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &RetryTransport{
+		next:    next,
+		options: newExponentialBackoffOptions(options),
+	}
+}
+
+// RoundTrip implements http.RoundTripper.
+//
+// Request bodies which can't be rewound with GetBody or io.Seeker are read in
+// memory, so they can be sent again.
+func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// A RoundTripper must not modify the request, which cloneWithBody may do.
+	return t.options.do(req.Clone(req.Context()), t.next.RoundTrip)
+}
@@ -0,0 +1,79 @@
+package httputilx
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetryTransport(t *testing.T) {
+	attempts := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != "request body" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte("wrong body: " + string(body)))
+			return
+		}
+		if attempts < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	client := &http.Client{Transport: NewRetryTransport(nil,
+		ExponentialBackoffWithPolicy(ExponentialPolicy(time.Millisecond, time.Millisecond, 1)))}
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL, io.NopCloser(strings.NewReader("request body")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "ok" {
+		t.Errorf("wrong response: %d %q", resp.StatusCode, body)
+	}
+	if attempts != 3 {
+		t.Errorf("expected 3 attempts, got %d", attempts)
+	}
+	if req.GetBody != nil {
+		t.Error("original request was modified")
+	}
+}
+
+func TestRetryTransportMaxRetries(t *testing.T) {
+	attempts := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	client := &http.Client{Transport: NewRetryTransport(http.DefaultTransport,
+		ExponentialBackoffWithMaxRetries(1),
+		ExponentialBackoffWithPolicy(ExponentialPolicy(time.Millisecond, time.Millisecond, 1)))}
+
+	resp, err := client.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("wrong status: %d", resp.StatusCode)
+	}
+	if attempts != 2 {
+		t.Errorf("expected 2 attempts, got %d", attempts)
+	}
+}
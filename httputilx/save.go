@@ -0,0 +1,343 @@
+package httputilx
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrTooLarge is used when the response body is larger than the maximum size.
+var ErrTooLarge = errors.New("response body too large")
+
+// ErrChecksum is used when the checksum of a downloaded file doesn't match.
+type ErrChecksum struct {
+	URL       string
+	Got, Want string
+}
+
+func (e ErrChecksum) Error() string {
+	return fmt.Sprintf("checksum mismatch for %v: got sha256 %v, want %v", e.URL, e.Got, e.Want)
+}
+
+type saveOptions struct {
+	client   *http.Client
+	resume   bool
+	atomic   bool
+	maxSize  int64
+	sha256   string
+	progress func(written, total int64)
+}
+
+// SaveOption is a function that configures Save and SaveContext.
+type SaveOption func(*saveOptions)
+
+// SaveWithClient sets the HTTP client to be used. By default, SaveContext uses
+// a client without a timeout, and Save uses a client with a 60s timeout; this
+// includes reading the body, so use SaveContext with a context deadline for
+// large files.
+func SaveWithClient(client *http.Client) SaveOption {
+	return func(o *saveOptions) {
+		o.client = client
+	}
+}
+
+// SaveWithResume resumes the download if a partial file exists, by requesting
+// the remaining data with a Range header. The download starts from the
+// beginning if the server doesn't support ranges.
+//
+// A partial file is kept on errors, so that the download can be resumed.
+func SaveWithResume() SaveOption {
+	return func(o *saveOptions) {
+		o.resume = true
+	}
+}
+
+// SaveWithAtomic writes the file as filename.part, and renames it to filename
+// once the download is complete. The filename will never contain a partial or
+// unverified file.
+//
+// Nothing is written for non-200 responses, and the .part file is removed on
+// errors unless SaveWithResume is used.
+func SaveWithAtomic() SaveOption {
+	return func(o *saveOptions) {
+		o.atomic = true
+	}
+}
+
+// SaveWithMaxSize sets the maximum size of the file in bytes; ErrTooLarge is
+// returned if it's larger. By default, there is no limit.
+func SaveWithMaxSize(maxSize int64) SaveOption {
+	return func(o *saveOptions) {
+		o.maxSize = maxSize
+	}
+}
+
+// SaveWithSHA256 verifies the SHA-256 checksum of the file, as a hex string.
+// ErrChecksum is returned and the file is removed if it doesn't match.
+func SaveWithSHA256(checksum string) SaveOption {
+	return func(o *saveOptions) {
+		o.sha256 = strings.ToLower(checksum)
+	}
+}
+
+// SaveWithProgress sets a function which is called after every write with the
+// number of bytes written so far and the total size, which is -1 if unknown.
+// Both include the size of the partial file when resuming.
+func SaveWithProgress(progress func(written, total int64)) SaveOption {
+	return func(o *saveOptions) {
+		o.progress = progress
+	}
+}
+
+// SaveContext saves an HTTP URL to the directory dir with the filename, like
+// Save. The download is aborted when the context is cancelled; unlike Save,
+// there is no default timeout.
+func SaveContext(ctx context.Context, url, dir, filename string, options ...SaveOption) (string, error) {
+	o := saveOptions{client: &http.Client{}}
+	for _, option := range options {
+		option(&o)
+	}
+
+	if filename == "" {
+		var err error
+		filename, err = filenameFromURL(url)
+		if err != nil {
+			return "", err
+		}
+	}
+	if !filepath.IsLocal(filename) {
+		return "", errors.Errorf("invalid filename %q", filename)
+	}
+	dest := filepath.Join(dir, filename)
+	tmp := dest
+	if o.atomic {
+		tmp = dest + ".part"
+	}
+
+	var offset int64
+	if o.resume {
+		if st, err := os.Stat(tmp); err == nil && st.Mode().IsRegular() {
+			offset = st.Size()
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot download %v", url)
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	response, err := o.client.Do(req)
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot download %v", url)
+	}
+	defer response.Body.Close() // nolint: errcheck
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	body := io.Reader(response.Body)
+	switch {
+	case offset > 0 && response.StatusCode == http.StatusPartialContent:
+		if start, _ := parseContentRange(response.Header.Get("Content-Range")); start != offset {
+			return "", errors.Errorf("cannot resume %v: unexpected Content-Range %q",
+				url, response.Header.Get("Content-Range"))
+		}
+		flags = os.O_WRONLY | os.O_APPEND
+	case offset > 0 && response.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		// Partial file is already complete; it's not if it's larger than the
+		// remote file, in which case we start over.
+		if _, size := parseContentRange(response.Header.Get("Content-Range")); size != offset {
+			if err := os.Remove(tmp); err != nil {
+				return "", err
+			}
+			return SaveContext(ctx, url, dir, filename, options...)
+		}
+		flags = os.O_WRONLY | os.O_APPEND
+		body = http.NoBody
+	case offset > 0 && response.StatusCode != http.StatusOK:
+		// Keep the partial file, so it can be resumed later.
+		snippet, _ := io.ReadAll(io.LimitReader(response.Body, maxErrorBody))
+		return "", newErrNotOK(url, response, snippet)
+	default:
+		// Server doesn't support ranges; start over.
+		offset = 0
+	}
+
+	notOK := response.StatusCode != http.StatusOK && flags&os.O_APPEND == 0
+	if notOK && o.atomic {
+		snippet, _ := io.ReadAll(io.LimitReader(response.Body, maxErrorBody))
+		return "", newErrNotOK(url, response, snippet)
+	}
+
+	total := int64(-1)
+	if response.ContentLength >= 0 && body != http.NoBody {
+		total = offset + response.ContentLength
+	} else if body == http.NoBody {
+		total = offset
+	}
+	if o.maxSize > 0 && total > o.maxSize {
+		return "", errors.Wrapf(ErrTooLarge, "cannot download %v: size %d exceeds %d", url, total, o.maxSize)
+	}
+
+	written, sum, err := o.write(tmp, flags, body, offset, total)
+	if err != nil {
+		if o.atomic && !o.resume {
+			_ = os.Remove(tmp)
+		}
+		if o.atomic {
+			return "", errors.Wrapf(err, "cannot read body of %v in to %v", url, tmp)
+		}
+		return dest, errors.Wrapf(err, "cannot read body of %v in to %v", url, tmp)
+	}
+
+	if notOK {
+		snippet, _ := readSnippet(tmp)
+		return dest, newErrNotOK(url, response, snippet)
+	}
+	if total >= 0 && written != total {
+		return "", errors.Errorf("cannot download %v: got %d bytes, want %d", url, written, total)
+	}
+
+	if o.sha256 != "" && sum != o.sha256 {
+		_ = os.Remove(tmp)
+		return "", ErrChecksum{URL: url, Got: sum, Want: o.sha256}
+	}
+
+	if o.atomic {
+		if err := os.Rename(tmp, dest); err != nil {
+			return "", err
+		}
+	}
+	return dest, nil
+}
+
+// write the body to the file at path, returning the total size and the
+// checksum (if requested).
+func (o saveOptions) write(path string, flags int, body io.Reader, offset, total int64) (int64, string, error) {
+	var h hash.Hash
+	if o.sha256 != "" {
+		h = sha256.New()
+		if offset > 0 {
+			if err := hashFile(h, path); err != nil {
+				return 0, "", err
+			}
+		}
+	}
+
+	output, err := os.OpenFile(path, flags, 0o644)
+	if err != nil {
+		return 0, "", errors.Wrapf(err, "cannot create %v", path)
+	}
+	defer output.Close() // nolint: errcheck
+
+	w := &progressWriter{w: output, h: h, written: offset, total: total, progress: o.progress}
+	if o.maxSize > 0 {
+		body = io.LimitReader(body, o.maxSize-offset+1)
+	}
+	if _, err := io.Copy(w, body); err != nil {
+		return w.written, "", err
+	}
+	if o.maxSize > 0 && w.written > o.maxSize {
+		return w.written, "", ErrTooLarge
+	}
+	if err := output.Close(); err != nil {
+		return w.written, "", err
+	}
+
+	var sum string
+	if h != nil {
+		sum = hex.EncodeToString(h.Sum(nil))
+	}
+	return w.written, sum, nil
+}
+
+// readSnippet reads the start of the file at path for ErrNotOK.
+func readSnippet(path string) ([]byte, error) {
+	fp, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close() // nolint: errcheck
+	return io.ReadAll(io.LimitReader(fp, maxErrorBody))
+}
+
+func hashFile(h hash.Hash, path string) error {
+	fp, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fp.Close() // nolint: errcheck
+	_, err = io.Copy(h, fp)
+	return err
+}
+
+type progressWriter struct {
+	w        io.Writer
+	h        hash.Hash
+	written  int64
+	total    int64
+	progress func(written, total int64)
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	if w.h != nil {
+		w.h.Write(p[:n])
+	}
+	w.written += int64(n)
+	if w.progress != nil {
+		w.progress(w.written, w.total)
+	}
+	return n, err
+}
+
+// filenameFromURL gets the last path element of the URL, without the query
+// string or fragment.
+func filenameFromURL(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot download %v", rawURL)
+	}
+
+	name := path.Base(u.Path)
+	if name == "." || name == "/" || name == ".." {
+		return "", errors.Errorf("cannot get filename from %v", rawURL)
+	}
+	return name, nil
+}
+
+// parseContentRange parses the start and total size from a Content-Range
+// header, as "bytes start-end/size" or "bytes */size". Either is -1 if it's
+// not known.
+func parseContentRange(v string) (start, size int64) {
+	start, size = -1, -1
+	v, ok := strings.CutPrefix(v, "bytes ")
+	if !ok {
+		return start, size
+	}
+	rng, sz, ok := strings.Cut(v, "/")
+	if !ok {
+		return start, size
+	}
+	if n, err := strconv.ParseInt(sz, 10, 64); err == nil {
+		size = n
+	}
+	if s, _, ok := strings.Cut(rng, "-"); ok {
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			start = n
+		}
+	}
+	return start, size
+}
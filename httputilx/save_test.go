@@ -0,0 +1,191 @@
+package httputilx
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/teamwork/test"
+)
+
+func testSaveServer(t *testing.T, content []byte) (*httptest.Server, *[]string) {
+	t.Helper()
+	var ranges []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/404") {
+			http.NotFound(w, r)
+			return
+		}
+		ranges = append(ranges, r.Header.Get("Range"))
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+	t.Cleanup(ts.Close)
+	return ts, &ranges
+}
+
+func TestSave(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	sum := sha256.Sum256(content)
+	checksum := hex.EncodeToString(sum[:])
+	ts, _ := testSaveServer(t, content)
+
+	tests := []struct {
+		name     string
+		url      string
+		filename string
+		options  []SaveOption
+		wantFile string
+		wantErr  string
+	}{
+		{"basic", "/file.txt", "", nil, "file.txt", ""},
+		{"query string", "/dir/file.txt?a=b#c", "", nil, "file.txt", ""},
+		{"filename", "/file.txt", "other.txt", nil, "other.txt", ""},
+		{"no filename", "/", "", nil, "", "cannot get filename"},
+		{"traversal", "/file.txt", "../file.txt", nil, "", "invalid filename"},
+		{"absolute", "/file.txt", "/etc/passwd", nil, "", "invalid filename"},
+		{"checksum", "/file.txt", "", []SaveOption{SaveWithSHA256(strings.ToUpper(checksum))}, "file.txt", ""},
+		{"checksum mismatch", "/file.txt", "", []SaveOption{SaveWithSHA256("abc")}, "", "checksum mismatch"},
+		{"max size", "/file.txt", "", []SaveOption{SaveWithMaxSize(int64(len(content)))}, "file.txt", ""},
+		{"too large", "/file.txt", "", []SaveOption{SaveWithMaxSize(100)}, "", "too large"},
+		{"not found", "/404.txt", "", nil, "404.txt", "404"},
+		{"not found atomic", "/404.txt", "", []SaveOption{SaveWithAtomic()}, "", "404"},
+		{"atomic", "/file.txt", "", []SaveOption{SaveWithAtomic()}, "file.txt", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			out, err := Save(ts.URL+tt.url, dir, tt.filename, tt.options...)
+			if !test.ErrorContains(err, tt.wantErr) {
+				t.Fatalf("wrong error\nout:  %v\nwant: %v", err, tt.wantErr)
+			}
+
+			var files []string
+			entries, _ := os.ReadDir(dir)
+			for _, e := range entries {
+				files = append(files, e.Name())
+			}
+			if tt.wantFile == "" {
+				if len(files) > 0 {
+					t.Errorf("files left behind: %v", files)
+				}
+				return
+			}
+			if len(files) != 1 || files[0] != tt.wantFile {
+				t.Fatalf("wrong files: %v", files)
+			}
+			if out != filepath.Join(dir, tt.wantFile) {
+				t.Errorf("wrong path: %v", out)
+			}
+			if tt.wantErr == "" {
+				got, _ := os.ReadFile(out)
+				if !bytes.Equal(got, content) {
+					t.Error("wrong content")
+				}
+			}
+		})
+	}
+}
+
+func TestSaveResume(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	sum := sha256.Sum256(content)
+	ts, ranges := testSaveServer(t, content)
+
+	for _, atomic := range []bool{false, true} {
+		t.Run("", func(t *testing.T) {
+			*ranges = nil
+			dir := t.TempDir()
+			partial := filepath.Join(dir, "file.txt")
+			options := []SaveOption{SaveWithResume(), SaveWithSHA256(hex.EncodeToString(sum[:]))}
+			if atomic {
+				partial += ".part"
+				options = append(options, SaveWithAtomic())
+			}
+			if err := os.WriteFile(partial, content[:1234], 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			var progress []int64
+			options = append(options, SaveWithProgress(func(written, total int64) {
+				if total != int64(len(content)) {
+					t.Errorf("wrong total: %d", total)
+				}
+				progress = append(progress, written)
+			}))
+
+			out, err := Save(ts.URL+"/file.txt", dir, "", options...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, _ := os.ReadFile(out)
+			if !bytes.Equal(got, content) {
+				t.Error("wrong content")
+			}
+			if len(*ranges) != 1 || (*ranges)[0] != "bytes=1234-" {
+				t.Errorf("wrong Range headers: %v", *ranges)
+			}
+			if len(progress) == 0 || progress[len(progress)-1] != int64(len(content)) {
+				t.Errorf("wrong progress: %v", progress)
+			}
+
+			// Already complete.
+			if atomic {
+				if err := os.Rename(out, partial); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := Save(ts.URL+"/file.txt", dir, "", options...); err != nil {
+					t.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestSaveResumeError(t *testing.T) {
+	ts, _ := testSaveServer(t, nil)
+	dir := t.TempDir()
+	partial := filepath.Join(dir, "404.txt")
+	if err := os.WriteFile(partial, []byte("partial-data-1234"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := Save(ts.URL+"/404.txt", dir, "", SaveWithResume())
+	var notOK ErrNotOK
+	if !errors.As(err, &notOK) {
+		t.Fatalf("wrong error: %v", err)
+	}
+	got, _ := os.ReadFile(partial)
+	if string(got) != "partial-data-1234" {
+		t.Errorf("partial file changed: %q", got)
+	}
+}
+
+func TestSaveContext(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	dir := t.TempDir()
+	_, err := SaveContext(ctx, ts.URL+"/file", dir, "", SaveWithAtomic())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("wrong error: %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) > 0 {
+		t.Errorf("files left behind: %v", entries)
+	}
+}
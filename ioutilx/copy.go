@@ -6,10 +6,15 @@ package ioutilx
 // This code is based on: https://github.com/termie/go-shutil
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
@@ -118,6 +123,10 @@ func IsSymlink(fi os.FileInfo) bool {
 
 // CopyData copies the file data from the file in src to the path in dst.
 //
+// On Linux it tries to create a reflink (on btrfs, XFS, and other filesystems
+// that support it), or copies the data in the kernel with copy_file_range(2) or
+// sendfile(2). Holes in sparse files are preserved.
+//
 // Note that this only copies data; permissions and other special file bits may
 // get lost.
 func CopyData(src, dst string) error {
@@ -143,7 +152,7 @@ func CopyData(src, dst string) error {
 	}
 	defer fdst.Close() // nolint: errcheck
 
-	size, err := io.Copy(fdst, fsrc)
+	size, err := copyFile(fdst, fsrc, srcStat.Size())
 	if err != nil {
 		return errors.Wrap(err, "copy failed")
 	}
@@ -234,6 +243,68 @@ func CopyMode(src, dst string, modes Modes) error {
 	return nil
 }
 
+// CopyStat copies the permission bits, access and modification times, extended
+// attributes, and (on Linux) inode flags from src to dst. The file contents and
+// owner are not copied.
+//
+// If followSymlinks is false and both src and dst are symlinks, the stats of
+// the symlinks are copied instead of the files they point to; symlinks are
+// followed otherwise. Permission bits and flags are not copied for symlinks.
+//
+// Extended attributes that can't be set on dst because they're not supported
+// by the filesystem or not permitted are skipped.
+func CopyStat(src, dst string, followSymlinks bool) error {
+	links := false
+	if !followSymlinks {
+		srcStat, err := os.Lstat(src)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		dstStat, err := os.Lstat(dst)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		links = IsSymlink(srcStat) && IsSymlink(dstStat)
+	}
+
+	stat := os.Stat
+	if links {
+		stat = os.Lstat
+	}
+	srcStat, err := stat(src)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if _, err := stat(dst); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if links {
+		err = lchtimes(dst, accessTime(srcStat), srcStat.ModTime())
+	} else {
+		err = os.Chtimes(dst, accessTime(srcStat), srcStat.ModTime())
+	}
+	if err != nil {
+		return errors.Wrap(err, "could not set times")
+	}
+
+	if err := copyXattrs(src, dst, !links); err != nil {
+		return errors.Wrap(err, "could not copy extended attributes")
+	}
+
+	if links {
+		return nil
+	}
+	if err := os.Chmod(dst, srcStat.Mode()); err != nil {
+		return errors.Wrap(err, "could not chmod")
+	}
+	// Do this last, as flags such as "immutable" prevent other changes.
+	if err := copyFlags(src, dst); err != nil {
+		return errors.Wrap(err, "could not copy flags")
+	}
+	return nil
+}
+
 // Copy data and the given mode bits; this is the same as a CopyData() followed
 // by a CopyMode().
 //
@@ -258,12 +329,152 @@ func Copy(src, dst string, modes Modes) error {
 	return errors.WithStack(CopyMode(src, dst, modes))
 }
 
+// Copy2 is like Copy(), but also copies the times, extended attributes, and
+// flags with CopyStat(). The modes are ignored except for Owner.
+//
+// It can be used as CopyTreeOptions.CopyFunction; set CopyTreeOptions.CopyStat
+// as well to also copy the stats of directories and symlinks.
+func Copy2(src, dst string, modes Modes) error {
+	dstInfo, err := os.Stat(dst)
+	if err == nil && dstInfo.Mode().IsDir() {
+		dst = filepath.Join(dst, filepath.Base(src))
+	}
+
+	if err != nil && !os.IsNotExist(err) {
+		return errors.WithStack(err)
+	}
+
+	if err = CopyData(src, dst); err != nil {
+		return errors.WithStack(err)
+	}
+	if modes.Owner {
+		if err := CopyMode(src, dst, Modes{Owner: true}); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return errors.WithStack(CopyStat(src, dst, true))
+}
+
 // CopyTreeOptions are flags for the CopyTree function.
 type CopyTreeOptions struct {
 	Symlinks               bool
 	IgnoreDanglingSymlinks bool
 	CopyFunction           func(string, string, Modes) error
 	Ignore                 func(string, []os.FileInfo) []string
+
+	// Workers is the number of files to copy in parallel; 0 means 1.
+	Workers int
+
+	// Progress is called after every file is copied. Calls are never
+	// concurrent, so it doesn't need to be safe for concurrent use.
+	Progress func(CopyProgress)
+
+	// Mode controls what happens if the destination exists; by default it
+	// must not exist.
+	Mode CopyTreeMode
+
+	// Compare controls how files are compared with CopyTreeUpdate and
+	// CopyTreeMirror.
+	Compare CopyTreeCompare
+
+	// CopyStat copies the stats of directories with CopyStat() after all their
+	// contents are copied, and the stats of symlinks if Symlinks is set. Use
+	// with Copy2() as the CopyFunction to preserve the stats of the entire
+	// tree.
+	CopyStat bool
+}
+
+// CopyTreeMode controls what CopyTree() does if the destination exists.
+type CopyTreeMode int
+
+// Modes for CopyTreeOptions.Mode.
+const (
+	// CopyTreeNew requires that the destination doesn't exist.
+	CopyTreeNew CopyTreeMode = iota
+
+	// CopyTreeMerge copies in to an existing destination, overwriting existing
+	// files.
+	CopyTreeMerge
+
+	// CopyTreeUpdate is like CopyTreeMerge, but only overwrites files that are
+	// different according to CopyTreeOptions.Compare.
+	CopyTreeUpdate
+
+	// CopyTreeMirror is like CopyTreeUpdate, but also deletes files and
+	// directories in the destination that aren't in the source, like "rsync
+	// --delete". Files in the destination for which Ignore returns the name
+	// are kept. A directory in the destination is also
+	// replaced if the source is a file, and vice versa; the other modes return
+	// an error for this.
+	CopyTreeMirror
+)
+
+// CopyTreeCompare controls how files are compared with CopyTreeUpdate and
+// CopyTreeMirror.
+type CopyTreeCompare int
+
+// Comparisons for CopyTreeOptions.Compare.
+const (
+	// CompareSizeModTime copies files if the size is different, or if the
+	// source was modified after the destination.
+	CompareSizeModTime CopyTreeCompare = iota
+
+	// CompareChecksum copies files if the contents are different. This reads
+	// both files completely if they have the same size.
+	CompareChecksum
+)
+
+// CopyOp is the type of a CopyAction.
+type CopyOp int
+
+// Operations for CopyAction.
+const (
+	CopyOpMkdir   CopyOp = iota // Create the directory Dst.
+	CopyOpCopy                  // Copy the file Src to Dst, overwriting Dst.
+	CopyOpSymlink               // Create a symlink Dst pointing to Src, overwriting Dst.
+	CopyOpDelete                // Delete Dst and everything in it.
+	CopyOpStat                  // Copy the stats from Src to Dst with CopyStat().
+)
+
+func (o CopyOp) String() string {
+	switch o {
+	case CopyOpMkdir:
+		return "mkdir"
+	case CopyOpCopy:
+		return "copy"
+	case CopyOpSymlink:
+		return "symlink"
+	case CopyOpDelete:
+		return "delete"
+	case CopyOpStat:
+		return "stat"
+	}
+	return fmt.Sprintf("CopyOp(%d)", int(o))
+}
+
+// CopyAction is an action CopyTree() takes, as returned by PlanCopyTree().
+type CopyAction struct {
+	Op   CopyOp
+	Src  string // Empty for CopyOpDelete.
+	Dst  string
+	Size int64 // Size of the file for CopyOpCopy.
+}
+
+func (a CopyAction) String() string {
+	if a.Src == "" {
+		return fmt.Sprintf("%v %v", a.Op, a.Dst)
+	}
+	return fmt.Sprintf("%v %v %v", a.Op, a.Src, a.Dst)
+}
+
+// CopyProgress is the progress reported to CopyTreeOptions.Progress.
+type CopyProgress struct {
+	Path       string // Source path of the file that was copied.
+	Err        error  // Error copying Path, if any.
+	Files      int    // Number of files done so far, including failed ones.
+	TotalFiles int
+	Bytes      int64 // Size of all files done so far.
+	TotalBytes int64
 }
 
 // DefaultCopyTreeOptions is used when the options to CopyTree() is nil.
@@ -274,9 +485,30 @@ var DefaultCopyTreeOptions = &CopyTreeOptions{
 	IgnoreDanglingSymlinks: false,
 }
 
+// ErrCopyTree is used when one or more paths couldn't be copied by CopyTree();
+// Errors is a list of *os.PathError for every path that failed, sorted by path.
+type ErrCopyTree struct {
+	Errors []error
+}
+
+func (e ErrCopyTree) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "copying %d paths failed:", len(e.Errors))
+	for _, err := range e.Errors {
+		b.WriteString("\n\t")
+		b.WriteString(err.Error())
+	}
+	return b.String()
+}
+
+func (e ErrCopyTree) Unwrap() []error {
+	return e.Errors
+}
+
 // CopyTree recursively copies a directory tree.
 //
-// The destination directory must not already exist.
+// The destination directory must not already exist, unless a different
+// options.Mode is used.
 //
 // If the optional Symlinks flag is true, symbolic links in the source tree
 // result in symbolic links in the destination tree; if it is false, the
@@ -300,8 +532,40 @@ var DefaultCopyTreeOptions = &CopyTreeOptions{
 // The optional copyFunction argument is a callable that will be used to copy
 // each file. It will be called with the source path and the destination path as
 // arguments. By default, Copy() is used, but any function that supports the
-// same signature (like Copy2() when it exists) can be used.
+// same signature (like Copy2()) can be used.
+//
+// Copying continues if a file or directory can't be copied; an ErrCopyTree
+// with all paths that failed is returned at the end.
 func CopyTree(src, dst string, options *CopyTreeOptions) error {
+	return CopyTreeContext(context.Background(), src, dst, options)
+}
+
+// CopyTreeContext recursively copies a directory tree like CopyTree(), using
+// options.Workers to copy files in parallel.
+//
+// It stops when the context is cancelled, and returns the context's error. The
+// files copied so far are not removed.
+func CopyTreeContext(ctx context.Context, src, dst string, options *CopyTreeOptions) error {
+	t, err := planCopyTree(ctx, src, dst, options)
+	if err != nil {
+		return err
+	}
+	t.run()
+	return t.err()
+}
+
+// PlanCopyTree returns the actions CopyTree() would take, without changing
+// anything. Errors reading the source or destination are returned as
+// ErrCopyTree along with the actions for all other paths.
+func PlanCopyTree(ctx context.Context, src, dst string, options *CopyTreeOptions) ([]CopyAction, error) {
+	t, err := planCopyTree(ctx, src, dst, options)
+	if err != nil {
+		return nil, err
+	}
+	return t.actions, t.err()
+}
+
+func planCopyTree(ctx context.Context, src, dst string, options *CopyTreeOptions) (*copyTree, error) {
 	if options == nil {
 		options = DefaultCopyTreeOptions
 	}
@@ -309,35 +573,110 @@ func CopyTree(src, dst string, options *CopyTreeOptions) error {
 	// Sanity checks.
 	srcFileInfo, err := os.Stat(src)
 	if err != nil {
-		return errors.WithStack(err)
+		return nil, errors.WithStack(err)
 	}
 	if !srcFileInfo.IsDir() {
-		return &ErrNotDir{src}
+		return nil, &ErrNotDir{src}
 	}
-	_, err = os.Open(dst)
-	if !os.IsNotExist(err) {
-		return &ErrExists{dst}
+	if options.Mode == CopyTreeNew {
+		if _, err := os.Lstat(dst); err == nil {
+			return nil, &ErrExists{dst}
+		}
+	}
+	dstFileInfo, err := os.Stat(dst)
+	switch {
+	case err == nil && !dstFileInfo.IsDir():
+		return nil, &ErrNotDir{dst}
+	case err != nil && !os.IsNotExist(err):
+		return nil, errors.WithStack(err)
 	}
 
-	entries, err := os.ReadDir(src)
-	if err != nil {
-		return errors.Wrapf(err, "could not read %v", src)
+	t := &copyTree{ctx: ctx, options: options}
+	if dstFileInfo == nil {
+		t.plan(CopyAction{Op: CopyOpMkdir, Src: src, Dst: dst})
 	}
-	fileInfos := make([]os.FileInfo, 0)
-	for _, entry := range entries {
-		if info, err := entry.Info(); err != nil {
-			fileInfos = append(fileInfos, info)
-		}
+	t.walk(src, dst, dstFileInfo != nil)
+	t.planStat(src, dst)
+	if err := ctx.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return t, nil
+}
+
+type copyTree struct {
+	ctx     context.Context
+	options *CopyTreeOptions
+	actions []CopyAction
+
+	mu       sync.Mutex
+	errs     []error
+	progress CopyProgress
+}
+
+func (t *copyTree) fail(path string, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.errs = append(t.errs, &os.PathError{Op: "copy", Path: path, Err: err})
+}
+
+func (t *copyTree) err() error {
+	if err := t.ctx.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+	if len(t.errs) == 0 {
+		return nil
 	}
+	sort.Slice(t.errs, func(i, j int) bool {
+		return t.errs[i].(*os.PathError).Path < t.errs[j].(*os.PathError).Path
+	})
+	return &ErrCopyTree{Errors: t.errs}
+}
+
+func (t *copyTree) plan(a CopyAction) {
+	t.actions = append(t.actions, a)
+	if a.Op == CopyOpCopy {
+		t.progress.TotalFiles++
+		t.progress.TotalBytes += a.Size
+	}
+}
 
-	// Create dst.
-	if err = os.MkdirAll(dst, srcFileInfo.Mode()); err != nil {
-		return errors.Wrapf(err, "could not create %v", dst)
+// walk the tree in src and plan the actions to copy it to dst.
+func (t *copyTree) walk(src, dst string, dstExists bool) {
+	if t.ctx.Err() != nil {
+		return
+	}
+
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		t.fail(src, errors.Wrapf(err, "could not read %v", src))
+		return
 	}
 
 	ignoredNames := []string{}
-	if options.Ignore != nil {
-		ignoredNames = options.Ignore(src, fileInfos)
+	if t.options.Ignore != nil {
+		fileInfos := make([]os.FileInfo, 0, len(entries))
+		for _, entry := range entries {
+			if info, err := entry.Info(); err == nil {
+				fileInfos = append(fileInfos, info)
+			}
+		}
+		ignoredNames = t.options.Ignore(src, fileInfos)
+	}
+
+	// Existing files in dst.
+	var dstEntries map[string]os.FileInfo
+	if dstExists {
+		entries, err := os.ReadDir(dst)
+		if err != nil {
+			t.fail(src, errors.Wrapf(err, "could not read %v", dst))
+			return
+		}
+		dstEntries = make(map[string]os.FileInfo, len(entries))
+		for _, entry := range entries {
+			if info, err := entry.Info(); err == nil {
+				dstEntries[entry.Name()] = info
+			}
+		}
 	}
 
 	for _, entry := range entries {
@@ -347,10 +686,13 @@ func CopyTree(src, dst string, options *CopyTreeOptions) error {
 
 		srcPath := filepath.Join(src, entry.Name())
 		dstPath := filepath.Join(dst, entry.Name())
+		dstInfo := dstEntries[entry.Name()]
+		delete(dstEntries, entry.Name())
 
 		entryFileInfo, err := os.Lstat(srcPath)
 		if err != nil {
-			return errors.WithStack(err)
+			t.fail(srcPath, err)
+			continue
 		}
 
 		switch {
@@ -359,51 +701,283 @@ func CopyTree(src, dst string, options *CopyTreeOptions) error {
 		case IsSymlink(entryFileInfo):
 			linkTo, err := os.Readlink(srcPath)
 			if err != nil {
-				return errors.WithStack(err)
+				t.fail(srcPath, err)
+				continue
 			}
 			dir := filepath.Dir(srcPath)
 			linkTo, err = filepath.Abs(filepath.Join(dir, linkTo))
 			if err != nil {
-				return errors.WithStack(err)
+				t.fail(srcPath, err)
+				continue
 			}
 
-			if options.Symlinks {
-				err = os.Symlink(linkTo, dstPath)
-				if err != nil {
-					return errors.WithStack(err)
+			if t.options.Symlinks {
+				t.planSymlink(srcPath, linkTo, dstPath, dstInfo)
+				t.planStat(srcPath, dstPath)
+				continue
+			}
+
+			// ignore dangling symlink if flag is on
+			linkToStat, err := os.Stat(linkTo)
+			if err != nil {
+				if !os.IsNotExist(err) || !t.options.IgnoreDanglingSymlinks {
+					t.fail(srcPath, err)
 				}
-				// CopyStat(srcPath, dstPath, false)
-			} else {
-				// ignore dangling symlink if flag is on
-				linkToStat, err := os.Stat(linkTo)
-				if os.IsNotExist(err) && options.IgnoreDanglingSymlinks {
+				continue
+			}
+			t.planEntry(srcPath, dstPath, linkToStat, dstInfo)
+
+		// Anything else.
+		default:
+			t.planEntry(srcPath, dstPath, entryFileInfo, dstInfo)
+		}
+	}
+
+	// Anything left in dst isn't in src. Ignore is called for these as well,
+	// so that ignored files which only exist in dst are kept.
+	if t.options.Mode == CopyTreeMirror {
+		names := make([]string, 0, len(dstEntries))
+		for name := range dstEntries {
+			if !sliceutil.Contains(ignoredNames, name) {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		if t.options.Ignore != nil && len(names) > 0 {
+			fileInfos := make([]os.FileInfo, 0, len(names))
+			for _, name := range names {
+				fileInfos = append(fileInfos, dstEntries[name])
+			}
+			ignoredNames = t.options.Ignore(src, fileInfos)
+		}
+		for _, name := range names {
+			if !sliceutil.Contains(ignoredNames, name) {
+				t.plan(CopyAction{Op: CopyOpDelete, Dst: filepath.Join(dst, name)})
+			}
+		}
+	}
+}
+
+func (t *copyTree) planSymlink(src, linkTo, dst string, dstInfo os.FileInfo) {
+	if dstInfo != nil {
+		if IsSymlink(dstInfo) {
+			if cur, err := os.Readlink(dst); err == nil && cur == linkTo {
+				return
+			}
+		} else if !t.replace(src, dst, dstInfo) {
+			return
+		}
+	}
+	t.plan(CopyAction{Op: CopyOpSymlink, Src: linkTo, Dst: dst})
+}
+
+func (t *copyTree) planEntry(src, dst string, fi, dstInfo os.FileInfo) {
+	if fi.IsDir() {
+		switch {
+		case dstInfo == nil:
+			t.plan(CopyAction{Op: CopyOpMkdir, Src: src, Dst: dst})
+		case dstInfo.IsDir():
+			t.walk(src, dst, true)
+			t.planStat(src, dst)
+			return
+		case !t.replace(src, dst, dstInfo):
+			return
+		default:
+			t.plan(CopyAction{Op: CopyOpMkdir, Src: src, Dst: dst})
+		}
+		t.walk(src, dst, false)
+		t.planStat(src, dst)
+		return
+	}
+
+	if dstInfo != nil {
+		switch {
+		case dstInfo.IsDir():
+			if !t.replace(src, dst, dstInfo) {
+				return
+			}
+		case IsSymlink(dstInfo):
+			// Always replace symlinks, as we'd otherwise write to the file
+			// they point to.
+		case t.options.Mode == CopyTreeUpdate || t.options.Mode == CopyTreeMirror:
+			same, err := t.same(src, dst, fi, dstInfo)
+			if err != nil {
+				t.fail(src, err)
+				return
+			}
+			if same {
+				return
+			}
+		}
+	}
+	t.plan(CopyAction{Op: CopyOpCopy, Src: src, Dst: dst, Size: fi.Size()})
+}
+
+// planStat plans to copy the stats of a directory or symlink, if
+// options.CopyStat is set. Directories must be planned after their contents.
+func (t *copyTree) planStat(src, dst string) {
+	if t.options.CopyStat {
+		t.plan(CopyAction{Op: CopyOpStat, Src: src, Dst: dst})
+	}
+}
+
+// replace plans to delete dst, if it's a directory and src isn't (or vice
+// versa). This is only done with CopyTreeMirror; it's an error otherwise.
+func (t *copyTree) replace(src, dst string, dstInfo os.FileInfo) bool {
+	if t.options.Mode != CopyTreeMirror {
+		if dstInfo.IsDir() {
+			t.fail(src, errors.Errorf("%v is a directory", dst))
+		} else {
+			t.fail(src, &ErrNotDir{dst})
+		}
+		return false
+	}
+	t.plan(CopyAction{Op: CopyOpDelete, Dst: dst})
+	return true
+}
+
+// same reports if src and dst are the same according to options.Compare.
+func (t *copyTree) same(src, dst string, srcInfo, dstInfo os.FileInfo) (bool, error) {
+	if srcInfo.Size() != dstInfo.Size() {
+		return false, nil
+	}
+	if t.options.Compare != CompareChecksum {
+		return !srcInfo.ModTime().After(dstInfo.ModTime()), nil
+	}
+
+	fsrc, err := os.Open(src)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	defer fsrc.Close() // nolint: errcheck
+	fdst, err := os.Open(dst)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	defer fdst.Close() // nolint: errcheck
+
+	bsrc, bdst := make([]byte, 32*1024), make([]byte, 32*1024)
+	for {
+		n, err := io.ReadFull(fsrc, bsrc)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return false, errors.WithStack(err)
+		}
+		m, err2 := io.ReadFull(fdst, bdst[:n])
+		if err2 != nil && err2 != io.EOF {
+			if err2 == io.ErrUnexpectedEOF {
+				return false, nil
+			}
+			return false, errors.WithStack(err2)
+		}
+		if !bytes.Equal(bsrc[:n], bdst[:m]) {
+			return false, nil
+		}
+		if err != nil || n == 0 {
+			// Make sure dst doesn't have more data.
+			m, _ := fdst.Read(bdst[:1])
+			return m == 0, nil
+		}
+	}
+}
+
+// run all planned actions; the files are copied in parallel. Stats are copied
+// after all files are copied, as copying files changes the directory's mtime.
+func (t *copyTree) run() {
+	copyFn := t.options.CopyFunction
+	if copyFn == nil {
+		copyFn = Copy
+	}
+
+	var (
+		wg    sync.WaitGroup
+		jobs  = make(chan CopyAction)
+		stats []CopyAction
+	)
+	for range max(t.options.Workers, 1) {
+		wg.Go(func() {
+			for a := range jobs {
+				if t.ctx.Err() != nil {
 					continue
 				}
-
-				if linkToStat.IsDir() {
-					err = CopyTree(srcPath, dstPath, options)
-				} else {
-					err = options.CopyFunction(srcPath, dstPath, Modes{})
+				err := removeExisting(a.Dst)
+				if err == nil {
+					err = copyFn(a.Src, a.Dst, Modes{})
 				}
 				if err != nil {
-					return errors.WithStack(err)
+					t.fail(a.Src, err)
 				}
+				t.report(a, err)
 			}
+		})
+	}
 
-		// Dir
-		case entryFileInfo.IsDir():
-			err = CopyTree(srcPath, dstPath, options)
-			if err != nil {
-				return errors.WithStack(err)
-			}
+loop:
+	for _, a := range t.actions {
+		if t.ctx.Err() != nil {
+			break
+		}
 
-		// Anything else.
-		default:
-			err = options.CopyFunction(srcPath, dstPath, Modes{})
-			if err != nil {
-				return errors.WithStack(err)
+		var err error
+		switch a.Op {
+		case CopyOpCopy:
+			select {
+			case jobs <- a:
+			case <-t.ctx.Done():
+				break loop
 			}
+			continue
+		case CopyOpStat:
+			stats = append(stats, a)
+			continue
+		case CopyOpMkdir:
+			var fi os.FileInfo
+			if fi, err = os.Stat(a.Src); err == nil {
+				if err = os.MkdirAll(a.Dst, fi.Mode().Perm()); err != nil {
+					err = errors.Wrapf(err, "could not create %v", a.Dst)
+				}
+			}
+		case CopyOpSymlink:
+			if err = removeExisting(a.Dst); err == nil {
+				err = os.Symlink(a.Src, a.Dst)
+			}
+		case CopyOpDelete:
+			err = os.RemoveAll(a.Dst)
+		}
+		if err != nil {
+			path := a.Src
+			if path == "" {
+				path = a.Dst
+			}
+			t.fail(path, err)
 		}
 	}
+	close(jobs)
+	wg.Wait()
+
+	for _, a := range stats {
+		if t.ctx.Err() != nil {
+			break
+		}
+		if err := CopyStat(a.Src, a.Dst, false); err != nil {
+			t.fail(a.Src, err)
+		}
+	}
+}
+
+func removeExisting(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return errors.WithStack(err)
+	}
 	return nil
 }
+
+func (t *copyTree) report(a CopyAction, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.progress.Path, t.progress.Err = a.Src, err
+	t.progress.Files++
+	t.progress.Bytes += a.Size
+	if t.options.Progress != nil {
+		t.options.Progress(t.progress)
+	}
+}
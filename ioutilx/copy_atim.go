@@ -0,0 +1,13 @@
+//go:build dragonfly || linux || openbsd || solaris
+// +build dragonfly linux openbsd solaris
+
+package ioutilx
+
+import (
+	"syscall"
+	"time"
+)
+
+func statAtime(st *syscall.Stat_t) time.Time {
+	return time.Unix(st.Atim.Unix())
+}
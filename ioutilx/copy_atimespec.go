@@ -0,0 +1,13 @@
+//go:build darwin || freebsd || netbsd
+// +build darwin freebsd netbsd
+
+package ioutilx
+
+import (
+	"syscall"
+	"time"
+)
+
+func statAtime(st *syscall.Stat_t) time.Time {
+	return time.Unix(st.Atimespec.Unix())
+}
@@ -0,0 +1,216 @@
+package ioutilx
+
+import (
+	"bytes"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// copyXattrs copies all extended attributes from src to dst. Attributes that
+// can't be set on dst because they're not supported or not permitted (e.g.
+// "trusted." attributes for non-root users) are skipped.
+func copyXattrs(src, dst string, followSymlinks bool) error {
+	list, get, set := unix.Listxattr, unix.Getxattr, unix.Setxattr
+	if !followSymlinks {
+		list, get, set = unix.Llistxattr, unix.Lgetxattr, unix.Lsetxattr
+	}
+
+	names, err := xattrBuf(func(b []byte) (int, error) { return list(src, b) })
+	if err != nil {
+		if ignoreXattrErr(err) {
+			return nil
+		}
+		return &os.PathError{Op: "listxattr", Path: src, Err: err}
+	}
+
+	for _, name := range bytes.Split(names, []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+		value, err := xattrBuf(func(b []byte) (int, error) { return get(src, string(name), b) })
+		if err != nil {
+			if ignoreXattrErr(err) {
+				continue
+			}
+			return &os.PathError{Op: "getxattr", Path: src, Err: err}
+		}
+		if err := set(dst, string(name), value, 0); err != nil {
+			if ignoreXattrErr(err) || err == unix.EPERM {
+				continue
+			}
+			return &os.PathError{Op: "setxattr", Path: dst, Err: err}
+		}
+	}
+	return nil
+}
+
+// xattrBuf calls fn with a buffer large enough to hold the result.
+func xattrBuf(fn func([]byte) (int, error)) ([]byte, error) {
+	for {
+		n, err := fn(nil)
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			return nil, nil
+		}
+		b := make([]byte, n)
+		n, err = fn(b)
+		if err == unix.ERANGE {
+			continue // Grew between the calls.
+		}
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+
+func ignoreXattrErr(err error) bool {
+	return err == unix.ENOTSUP || err == unix.ENODATA || err == unix.EINVAL
+}
+
+// copyFlags copies the inode flags as shown by lsattr(1), such as "append
+// only" and "no dump". Nothing is done if the filesystem doesn't support
+// flags.
+func copyFlags(src, dst string) error {
+	flags, err := ioctlFlags(src, 0, false)
+	if err != nil || flags == 0 {
+		return err
+	}
+	_, err = ioctlFlags(dst, flags, true)
+	return err
+}
+
+func ioctlFlags(path string, flags uint32, set bool) (uint32, error) {
+	fp, err := os.OpenFile(path, os.O_RDONLY|unix.O_NONBLOCK, 0)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	defer fp.Close() // nolint: errcheck
+
+	if set {
+		err = unix.IoctlSetPointerInt(int(fp.Fd()), unix.FS_IOC_SETFLAGS, int(flags))
+	} else {
+		flags, err = unix.IoctlGetUint32(int(fp.Fd()), unix.FS_IOC_GETFLAGS)
+	}
+	switch {
+	case err == unix.ENOTTY || err == unix.ENOTSUP || err == unix.EINVAL:
+		return 0, nil
+	case err != nil:
+		return 0, &os.PathError{Op: "ioctl", Path: path, Err: err}
+	}
+	return flags, nil
+}
+
+// copyFile copies size bytes from src to dst. It tries a reflink with FICLONE
+// first, which shares the data blocks on filesystems like btrfs and XFS. If
+// that's not supported it copies every data region of src with
+// copy_file_range(2), sendfile(2), or io.Copy(), skipping holes in sparse
+// files.
+//
+// It returns the number of bytes in dst, including holes.
+func copyFile(dst, src *os.File, size int64) (int64, error) {
+	if size == 0 {
+		// Might be a file in /proc or /sys, which report a size of 0.
+		return io.Copy(dst, src)
+	}
+	dfd, sfd := int(dst.Fd()), int(src.Fd())
+
+	switch err := unix.IoctlFileClone(dfd, sfd); err {
+	case nil:
+		return size, nil
+	case unix.EXDEV, unix.EOPNOTSUPP, unix.EINVAL, unix.ENOTTY, unix.EBADF, unix.EPERM:
+		// Not supported for these files.
+	default:
+		return 0, &os.PathError{Op: "ioctl", Path: dst.Name(), Err: err}
+	}
+
+	var off int64
+	for off < size {
+		data, err := unix.Seek(sfd, off, unix.SEEK_DATA)
+		switch err {
+		case nil:
+		case unix.ENXIO:
+			// Only a hole after off.
+			data = size
+		case unix.EINVAL:
+			// SEEK_DATA not supported; copy everything.
+			data = off
+		default:
+			return off, &os.PathError{Op: "seek", Path: src.Name(), Err: err}
+		}
+		if data >= size {
+			break
+		}
+		hole, err := unix.Seek(sfd, data, unix.SEEK_HOLE)
+		if err != nil {
+			hole = size
+		}
+
+		n, err := copyRange(dst, src, data, min(hole, size)-data)
+		off = data + n
+		if err != nil {
+			return off, err
+		}
+		if n < min(hole, size)-data {
+			return off, nil // src was truncated.
+		}
+	}
+
+	// Create the hole at the end, if any.
+	if err := dst.Truncate(size); err != nil {
+		return off, errors.WithStack(err)
+	}
+	return size, nil
+}
+
+// copyRange copies n bytes at off from src to dst, at the same offset.
+func copyRange(dst, src *os.File, off, n int64) (int64, error) {
+	var (
+		dfd, sfd = int(dst.Fd()), int(src.Fd())
+		roff     = off
+		woff     = off
+	)
+	for roff < off+n {
+		c, err := unix.CopyFileRange(sfd, &roff, dfd, &woff, int(min(off+n-roff, 1<<30)), 0)
+		if err != nil {
+			if roff == off && (err == unix.ENOSYS || err == unix.EXDEV || err == unix.EINVAL || err == unix.EOPNOTSUPP) {
+				return sendfileRange(dst, src, off, n)
+			}
+			return roff - off, &os.PathError{Op: "copy_file_range", Path: dst.Name(), Err: err}
+		}
+		if c == 0 {
+			break // EOF
+		}
+	}
+	return roff - off, nil
+}
+
+// sendfileRange is like copyRange(), but uses sendfile(2), which works on more
+// filesystems than copy_file_range(2).
+func sendfileRange(dst, src *os.File, off, n int64) (int64, error) {
+	if _, err := dst.Seek(off, io.SeekStart); err != nil {
+		return 0, errors.WithStack(err)
+	}
+	var (
+		dfd, sfd = int(dst.Fd()), int(src.Fd())
+		roff     = off
+	)
+	for roff < off+n {
+		c, err := unix.Sendfile(dfd, sfd, &roff, int(min(off+n-roff, 1<<30)))
+		if err != nil {
+			if roff == off && (err == unix.ENOSYS || err == unix.EINVAL) {
+				return io.Copy(io.NewOffsetWriter(dst, off), io.NewSectionReader(src, off, n))
+			}
+			return roff - off, &os.PathError{Op: "sendfile", Path: dst.Name(), Err: err}
+		}
+		if c == 0 {
+			break // EOF
+		}
+	}
+	return roff - off, nil
+}
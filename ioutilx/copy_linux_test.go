@@ -0,0 +1,125 @@
+package ioutilx
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestCopyStatXattr(t *testing.T) {
+	tmp := t.TempDir()
+	src, dst := filepath.Join(tmp, "src"), filepath.Join(tmp, "dst")
+	touch(t, src)
+	touch(t, dst)
+
+	if err := unix.Setxattr(src, "user.test", []byte("value"), 0); err != nil {
+		t.Skipf("xattrs not supported: %v", err)
+	}
+	if err := CopyStat(src, dst, true); err != nil {
+		t.Fatal(err)
+	}
+
+	b := make([]byte, 64)
+	n, err := unix.Getxattr(dst, "user.test", b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b[:n]) != "value" {
+		t.Errorf("wrong value: %q", b[:n])
+	}
+}
+
+func TestCopyDataSparse(t *testing.T) {
+	tmp := t.TempDir()
+	src, dst := filepath.Join(tmp, "src"), filepath.Join(tmp, "dst")
+
+	// 1M data, 8M hole, 1M data, 4M hole.
+	fp, err := os.Create(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := bytes.Repeat([]byte("0123456789abcdef"), 1<<16)
+	if _, err := fp.WriteAt(data, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fp.WriteAt(data, 9<<20); err != nil {
+		t.Fatal(err)
+	}
+	if err := fp.Truncate(14 << 20); err != nil {
+		t.Fatal(err)
+	}
+	if err := fp.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CopyData(src, dst); err != nil {
+		t.Fatal(err)
+	}
+	filesMatch(t, src, dst)
+
+	srcStat, err := os.Stat(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dstStat, err := os.Stat(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dstStat.Size() != 14<<20 {
+		t.Errorf("wrong size: %d", dstStat.Size())
+	}
+	// Only if the filesystem supports sparse files.
+	srcBlocks := srcStat.Sys().(*syscall.Stat_t).Blocks
+	dstBlocks := dstStat.Sys().(*syscall.Stat_t).Blocks
+	if srcBlocks*512 < 14<<20 && dstBlocks*512 >= 14<<20 {
+		t.Errorf("holes not preserved: %d blocks; src has %d", dstBlocks, srcBlocks)
+	}
+}
+
+func TestCopyRange(t *testing.T) {
+	tmp := t.TempDir()
+	src, err := os.Create(filepath.Join(tmp, "src"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close() // nolint: errcheck
+	dst, err := os.Create(filepath.Join(tmp, "dst"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close() // nolint: errcheck
+
+	if _, err := src.WriteString("0123456789"); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, fn := range map[string]func(dst, src *os.File, off, n int64) (int64, error){
+		"copy_file_range": copyRange,
+		"sendfile":        sendfileRange,
+	} {
+		t.Run(name, func(t *testing.T) {
+			if err := dst.Truncate(0); err != nil {
+				t.Fatal(err)
+			}
+			// Reading past EOF stops.
+			n, err := fn(dst, src, 4, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != 6 {
+				t.Errorf("wrong n: %d", n)
+			}
+			got, err := os.ReadFile(dst.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != "\x00\x00\x00\x00456789" {
+				t.Errorf("wrong data: %q", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,22 @@
+//go:build !linux
+// +build !linux
+
+package ioutilx
+
+import (
+	"io"
+	"os"
+)
+
+func copyXattrs(src, dst string, followSymlinks bool) error {
+	// TODO: No-op
+	return nil
+}
+
+func copyFlags(src, dst string) error {
+	return nil
+}
+
+func copyFile(dst, src *os.File, size int64) (int64, error) {
+	return io.Copy(dst, src)
+}
@@ -2,13 +2,19 @@ package ioutilx
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"syscall"
 	"testing"
+	"time"
 
 	"github.com/teamwork/test"
+	"github.com/teamwork/test/diff"
 )
 
 func TestMain(m *testing.M) {
@@ -325,3 +331,367 @@ func TestCopyTree(t *testing.T) {
 
 	filesMatch(t, "test/file1", "test_copytree/file1")
 }
+
+// testTree creates a directory tree with n files in a few directories.
+func testTree(t *testing.T, n int) string {
+	t.Helper()
+	src := t.TempDir()
+	for i := range n {
+		dir := filepath.Join(src, fmt.Sprintf("dir%d", i%3), "sub")
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("file%d", i)), bytes.Repeat([]byte("x"), i), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return src
+}
+
+func TestCopyTreeContext(t *testing.T) {
+	t.Run("workers", func(t *testing.T) {
+		src := testTree(t, 50)
+		dst := filepath.Join(t.TempDir(), "dst")
+
+		var progress []CopyProgress
+		err := CopyTreeContext(context.Background(), src, dst, &CopyTreeOptions{
+			Workers:  4,
+			Progress: func(p CopyProgress) { progress = append(progress, p) },
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := range 50 {
+			p := filepath.Join(fmt.Sprintf("dir%d", i%3), "sub", fmt.Sprintf("file%d", i))
+			filesMatch(t, filepath.Join(src, p), filepath.Join(dst, p))
+		}
+
+		if len(progress) != 50 {
+			t.Fatalf("wrong number of progress calls: %d", len(progress))
+		}
+		last := progress[49]
+		if last.Files != 50 || last.TotalFiles != 50 || last.Bytes != 49*50/2 || last.TotalBytes != 49*50/2 {
+			t.Errorf("wrong progress: %+v", last)
+		}
+		if !strings.HasPrefix(last.Path, src) {
+			t.Errorf("wrong path: %v", last.Path)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		src := testTree(t, 10)
+		dst := filepath.Join(t.TempDir(), "dst")
+		if err := os.Symlink("nonexistent", filepath.Join(src, "dangling")); err != nil {
+			t.Fatal(err)
+		}
+
+		err := CopyTreeContext(context.Background(), src, dst, &CopyTreeOptions{
+			Workers: 2,
+			CopyFunction: func(src, dst string, m Modes) error {
+				if strings.HasSuffix(src, "file3") || strings.HasSuffix(src, "file7") {
+					return &ErrExists{dst}
+				}
+				return Copy(src, dst, m)
+			},
+		})
+
+		var copyErr *ErrCopyTree
+		if !errors.As(err, &copyErr) {
+			t.Fatalf("wrong error: %#v", err)
+		}
+		var paths []string
+		for _, e := range copyErr.Errors {
+			paths = append(paths, strings.TrimPrefix(e.(*os.PathError).Path, src))
+		}
+		want := []string{"/dangling", "/dir0/sub/file3", "/dir1/sub/file7"}
+		if !reflect.DeepEqual(paths, want) {
+			t.Errorf("\nout:  %v\nwant: %v", paths, want)
+		}
+		var exists *ErrExists
+		if !errors.As(err, &exists) {
+			t.Error("errors.As doesn't find ErrExists")
+		}
+		if !test.ErrorContains(err, "copying 3 paths failed") {
+			t.Errorf("wrong error: %v", err)
+		}
+
+		// All other files are copied.
+		filesMatch(t, filepath.Join(src, "dir2/sub/file8"), filepath.Join(dst, "dir2/sub/file8"))
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		src := testTree(t, 20)
+		dst := filepath.Join(t.TempDir(), "dst")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		files := 0
+		err := CopyTreeContext(ctx, src, dst, &CopyTreeOptions{
+			Progress: func(p CopyProgress) {
+				files = p.Files
+				cancel()
+			},
+		})
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("wrong error: %v", err)
+		}
+		if files == 0 || files == 20 {
+			t.Errorf("wrong number of files copied: %d", files)
+		}
+	})
+}
+
+func TestCopyTreeMode(t *testing.T) {
+	setup := func(t *testing.T) (string, string) {
+		t.Helper()
+		src, dst := t.TempDir(), t.TempDir()
+		write := func(p, data string) {
+			t.Helper()
+			if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(p, []byte(data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		mtime := time.Now().Add(-time.Hour)
+		chtimes := func(p string, tm time.Time) {
+			t.Helper()
+			if err := os.Chtimes(p, tm, tm); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		write(filepath.Join(src, "a"), "aaa")
+		write(filepath.Join(src, "b"), "bbb")
+		write(filepath.Join(src, "d", "c"), "ccc")
+		write(filepath.Join(src, "e", "f"), "f")
+		chtimes(filepath.Join(src, "a"), mtime)
+		chtimes(filepath.Join(src, "b"), mtime)
+
+		write(filepath.Join(dst, "a"), "aaa")         // Same.
+		write(filepath.Join(dst, "b"), "xxx")         // Same size and newer.
+		write(filepath.Join(dst, "d", "c"), "cc")     // Different size.
+		write(filepath.Join(dst, "e"), "e")           // File instead of dir.
+		write(filepath.Join(dst, "x"), "x")           // Not in src.
+		write(filepath.Join(dst, "ignore", "y"), "y") // Ignored.
+		chtimes(filepath.Join(dst, "a"), mtime)
+		return src, dst
+	}
+
+	tests := []struct {
+		mode    CopyTreeMode
+		compare CopyTreeCompare
+		want    []string
+		wantErr string
+	}{
+		{CopyTreeNew, CompareSizeModTime, nil, "already exists"},
+		{CopyTreeMerge, CompareSizeModTime, []string{
+			"copy src/a dst/a",
+			"copy src/b dst/b",
+			"copy src/d/c dst/d/c",
+		}, "/e is not a directory"},
+		{CopyTreeUpdate, CompareSizeModTime, []string{
+			"copy src/d/c dst/d/c",
+		}, "/e is not a directory"},
+		{CopyTreeUpdate, CompareChecksum, []string{
+			"copy src/b dst/b",
+			"copy src/d/c dst/d/c",
+		}, "/e is not a directory"},
+		{CopyTreeMirror, CompareSizeModTime, []string{
+			"copy src/d/c dst/d/c",
+			"delete dst/e",
+			"mkdir src/e dst/e",
+			"copy src/e/f dst/e/f",
+			"delete dst/x",
+		}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d-%d", tt.mode, tt.compare), func(t *testing.T) {
+			src, dst := setup(t)
+			actions, err := PlanCopyTree(context.Background(), src, dst, &CopyTreeOptions{
+				Mode:    tt.mode,
+				Compare: tt.compare,
+				Ignore: func(string, []os.FileInfo) []string {
+					return []string{"ignore"}
+				},
+			})
+			if !test.ErrorContains(err, tt.wantErr) {
+				t.Fatalf("wrong error\nout:  %v\nwant: %v", err, tt.wantErr)
+			}
+
+			r := strings.NewReplacer(src, "src", dst, "dst")
+			var out []string
+			for _, a := range actions {
+				out = append(out, r.Replace(a.String()))
+			}
+			if d := diff.Diff(strings.Join(tt.want, "\n"), strings.Join(out, "\n")); d != "" {
+				t.Error(d)
+			}
+
+			// Dry run doesn't change anything.
+			if _, err := os.Stat(filepath.Join(dst, "x")); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+
+	t.Run("mirror", func(t *testing.T) {
+		src, dst := setup(t)
+		err := CopyTree(src, dst, &CopyTreeOptions{
+			Mode:    CopyTreeMirror,
+			Compare: CompareChecksum,
+			Ignore: func(string, []os.FileInfo) []string {
+				return []string{"ignore"}
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range []string{"a", "b", "d/c", "e/f"} {
+			filesMatch(t, filepath.Join(src, p), filepath.Join(dst, p))
+		}
+		if _, err := os.Stat(filepath.Join(dst, "x")); !os.IsNotExist(err) {
+			t.Errorf("x not deleted: %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(dst, "ignore", "y")); err != nil {
+			t.Errorf("ignored file deleted: %v", err)
+		}
+	})
+
+	t.Run("mirror ignored in dst", func(t *testing.T) {
+		src, dst := setup(t)
+		touch(t, filepath.Join(dst, "local.log"))
+		touch(t, filepath.Join(dst, "d", "local.log"))
+
+		actions, err := PlanCopyTree(context.Background(), src, dst, &CopyTreeOptions{
+			Mode:   CopyTreeMirror,
+			Ignore: IgnorePatterns(src, "*.log", "/ignore/"),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, a := range actions {
+			if a.Op == CopyOpDelete && (strings.HasSuffix(a.Dst, ".log") || strings.HasSuffix(a.Dst, "ignore")) {
+				t.Errorf("ignored file deleted: %v", a)
+			}
+		}
+		if a := actions[len(actions)-1]; a.Op != CopyOpDelete || a.Dst != filepath.Join(dst, "x") {
+			t.Errorf("x not deleted: %v", a)
+		}
+	})
+
+	t.Run("missing dst", func(t *testing.T) {
+		src := testTree(t, 3)
+		dst := filepath.Join(t.TempDir(), "dst")
+		err := CopyTree(src, dst, &CopyTreeOptions{Mode: CopyTreeUpdate})
+		if err != nil {
+			t.Fatal(err)
+		}
+		filesMatch(t, filepath.Join(src, "dir2/sub/file2"), filepath.Join(dst, "dir2/sub/file2"))
+	})
+}
+
+func TestCopyStat(t *testing.T) {
+	tmp := t.TempDir()
+	src, dst := filepath.Join(tmp, "src"), filepath.Join(tmp, "dst")
+	touch(t, src)
+	touch(t, dst)
+
+	atime, mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(src, atime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(src, 0o640); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CopyStat(src, dst, true); err != nil {
+		t.Fatal(err)
+	}
+	st, err := os.Stat(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !st.ModTime().Equal(mtime) {
+		t.Errorf("wrong mtime: %v", st.ModTime())
+	}
+	if a := accessTime(st); !a.Equal(atime) {
+		t.Errorf("wrong atime: %v", a)
+	}
+	if st.Mode() != 0o640 {
+		t.Errorf("wrong mode: %v", st.Mode())
+	}
+
+	t.Run("symlinks", func(t *testing.T) {
+		srcLink, dstLink := filepath.Join(tmp, "srclink"), filepath.Join(tmp, "dstlink")
+		if err := os.Symlink(src, srcLink); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(dst, dstLink); err != nil {
+			t.Fatal(err)
+		}
+		if err := lchtimes(srcLink, atime, atime); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := CopyStat(srcLink, dstLink, false); err != nil {
+			t.Fatal(err)
+		}
+		st, err := os.Lstat(dstLink)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !st.ModTime().Equal(atime) {
+			t.Errorf("wrong mtime for link: %v", st.ModTime())
+		}
+		// Target isn't changed.
+		if st, _ := os.Stat(dst); !st.ModTime().Equal(mtime) {
+			t.Errorf("wrong mtime for target: %v", st.ModTime())
+		}
+	})
+}
+
+func TestCopyTreeCopyStat(t *testing.T) {
+	src := testTree(t, 6)
+	if err := os.Symlink("dir0", filepath.Join(src, "link")); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	paths := []string{"", "dir0", "dir0/sub", "dir1/sub/file4", "link"}
+	for _, p := range paths {
+		if err := lchtimes(filepath.Join(src, p), mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chmod(filepath.Join(src, "dir1"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := filepath.Join(t.TempDir(), "dst")
+	err := CopyTree(src, dst, &CopyTreeOptions{
+		Symlinks:     true,
+		CopyStat:     true,
+		CopyFunction: Copy2,
+		Workers:      2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range paths {
+		st, err := os.Lstat(filepath.Join(dst, p))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !st.ModTime().Equal(mtime) {
+			t.Errorf("wrong mtime for %q: %v", p, st.ModTime())
+		}
+	}
+	if st, _ := os.Stat(filepath.Join(dst, "dir1")); st.Mode().Perm() != 0o700 {
+		t.Errorf("wrong mode: %v", st.Mode())
+	}
+}
@@ -6,8 +6,10 @@ package ioutilx
 import (
 	"os"
 	"syscall"
+	"time"
 
 	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
 )
 
 func setOwner(srcStat os.FileInfo, dst string) error {
@@ -22,3 +24,21 @@ func setOwner(srcStat os.FileInfo, dst string) error {
 
 	return nil
 }
+
+func accessTime(fi os.FileInfo) time.Time {
+	statT, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fi.ModTime()
+	}
+	return statAtime(statT)
+}
+
+// lchtimes is like os.Chtimes(), but doesn't follow symlinks.
+func lchtimes(path string, atime, mtime time.Time) error {
+	ts := []unix.Timespec{unix.NsecToTimespec(atime.UnixNano()), unix.NsecToTimespec(mtime.UnixNano())}
+	err := unix.UtimesNanoAt(unix.AT_FDCWD, path, ts, unix.AT_SYMLINK_NOFOLLOW)
+	if err != nil {
+		return &os.PathError{Op: "lchtimes", Path: path, Err: err}
+	}
+	return nil
+}
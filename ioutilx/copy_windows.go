@@ -1,8 +1,25 @@
 package ioutilx
 
-import "os"
+import (
+	"os"
+	"syscall"
+	"time"
+)
 
 func setOwner(srcStat os.FileInfo, dst string) error {
 	// TODO: No-op
 	return nil
 }
+
+func accessTime(fi os.FileInfo) time.Time {
+	attr, ok := fi.Sys().(*syscall.Win32FileAttributeData)
+	if !ok {
+		return fi.ModTime()
+	}
+	return time.Unix(0, attr.LastAccessTime.Nanoseconds())
+}
+
+func lchtimes(path string, atime, mtime time.Time) error {
+	// TODO: No-op
+	return nil
+}
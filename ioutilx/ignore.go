@@ -0,0 +1,172 @@
+package ioutilx
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// IgnorePatterns returns a function for CopyTreeOptions.Ignore which ignores
+// files matching the patterns, using the same syntax as .gitignore files:
+//
+//   - blank lines and lines starting with # are skipped;
+//   - a pattern starting with ! re-includes files excluded by an earlier
+//     pattern; the last matching pattern wins;
+//   - a pattern ending with / only matches directories;
+//   - a pattern with a / at the start or in the middle is relative to root,
+//     otherwise it matches a name at any level;
+//   - *, ?, and [a-z] match as with path.Match(), and ** matches any number
+//     of directories, as in "**/foo", "foo/**", and "foo/**/bar".
+//
+// Like with git, a file can't be re-included if one of its parent directories
+// is ignored, as the directory isn't copied at all.
+//
+// The patterns are relative to root, which is usually the src passed to
+// CopyTree(). Nothing is ignored in directories outside of root.
+//
+// For example:
+//
+//	CopyTree(src, dst, &CopyTreeOptions{
+//	    Ignore: IgnorePatterns(src, "*.log", "!important.log", "/build/", "**/testdata/*.golden"),
+//	})
+func IgnorePatterns(root string, patterns ...string) func(string, []os.FileInfo) []string {
+	var rules []ignoreRule
+	for _, p := range patterns {
+		if r, ok := parseIgnoreRule(p); ok {
+			rules = append(rules, r)
+		}
+	}
+
+	return func(src string, entries []os.FileInfo) []string {
+		// CopyTree() joins paths with filepath.Join(), so "dir/" and "." for
+		// the root become "dir/sub" and "sub" for subdirectories.
+		absRoot, err := filepath.Abs(root)
+		if err != nil {
+			return nil
+		}
+		src, err = filepath.Abs(src)
+		if err != nil || !inDir(absRoot, src) {
+			return nil
+		}
+		rel, err := filepath.Rel(absRoot, src)
+		if err != nil {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+
+		var ignored []string
+		for _, e := range entries {
+			if matchIgnoreRules(rules, path.Join(rel, e.Name()), e.IsDir()) {
+				ignored = append(ignored, e.Name())
+			}
+		}
+		return ignored
+	}
+}
+
+// IgnorePatternsFromFile is like IgnorePatterns(), but reads the patterns
+// from a file in the .gitignore format.
+func IgnorePatternsFromFile(root, file string) (func(string, []os.FileInfo) []string, error) {
+	fp, err := os.Open(file)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer fp.Close() // nolint: errcheck
+
+	var patterns []string
+	scanner := bufio.NewScanner(fp)
+	for scanner.Scan() {
+		patterns = append(patterns, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "could not read %v", file)
+	}
+	return IgnorePatterns(root, patterns...), nil
+}
+
+func inDir(dir, p string) bool {
+	return p == dir || strings.HasPrefix(p, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
+
+type ignoreRule struct {
+	segments []string
+	negate   bool
+	dirOnly  bool
+}
+
+func parseIgnoreRule(p string) (ignoreRule, bool) {
+	var r ignoreRule
+	p = strings.TrimSuffix(p, "\r")
+
+	// Trailing spaces are removed, unless escaped with a backslash.
+	for strings.HasSuffix(p, " ") && !strings.HasSuffix(p, `\ `) {
+		p = p[:len(p)-1]
+	}
+	if p == "" || p[0] == '#' {
+		return r, false
+	}
+
+	switch {
+	case p[0] == '!':
+		r.negate, p = true, p[1:]
+	case strings.HasPrefix(p, `\!`), strings.HasPrefix(p, `\#`):
+		p = p[1:]
+	}
+	if strings.HasSuffix(p, "/") {
+		r.dirOnly, p = true, strings.TrimRight(p, "/")
+	}
+	if p == "" {
+		return r, false
+	}
+
+	// Without a slash it matches at any level.
+	if !strings.Contains(p, "/") {
+		p = "**/" + p
+	}
+	r.segments = strings.Split(strings.TrimPrefix(p, "/"), "/")
+	return r, true
+}
+
+func matchIgnoreRules(rules []ignoreRule, p string, isDir bool) bool {
+	ignored := false
+	for _, r := range rules {
+		if r.dirOnly && !isDir {
+			continue
+		}
+		if matchSegments(r.segments, strings.Split(p, "/")) {
+			ignored = !r.negate
+		}
+	}
+	return ignored
+}
+
+func matchSegments(pattern, names []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// A trailing ** matches everything inside, but not the directory
+			// itself.
+			if len(pattern) == 1 {
+				return len(names) > 0
+			}
+			for i := 0; i <= len(names); i++ {
+				if matchSegments(pattern[1:], names[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(names) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], names[0]); !ok || err != nil {
+			return false
+		}
+		pattern, names = pattern[1:], names[1:]
+	}
+	return len(names) == 0
+}
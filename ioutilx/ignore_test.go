@@ -0,0 +1,163 @@
+package ioutilx
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestMatchIgnoreRules(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		path     string
+		isDir    bool
+		want     bool
+	}{
+		{[]string{"*.log"}, "a.log", false, true},
+		{[]string{"*.log"}, "dir/sub/a.log", false, true},
+		{[]string{"*.log"}, "a.txt", false, false},
+		{[]string{"*.log", "!important.log"}, "dir/important.log", false, false},
+		{[]string{"!important.log", "*.log"}, "dir/important.log", false, true},
+		{[]string{"# comment", "", "  "}, "# comment", false, false},
+		{[]string{`\#file`}, "#file", false, true},
+		{[]string{`\!file`}, "!file", false, true},
+		{[]string{"trailing  "}, "trailing", false, true},
+		{[]string{`space\ `}, "space ", false, true},
+
+		// Directory only.
+		{[]string{"build/"}, "build", true, true},
+		{[]string{"build/"}, "build", false, false},
+		{[]string{"build/"}, "sub/build", true, true},
+
+		// Anchored.
+		{[]string{"/build"}, "build", true, true},
+		{[]string{"/build"}, "sub/build", true, false},
+		{[]string{"doc/*.txt"}, "doc/a.txt", false, true},
+		{[]string{"doc/*.txt"}, "doc/sub/a.txt", false, false},
+		{[]string{"doc/*.txt"}, "sub/doc/a.txt", false, false},
+
+		// Doublestar.
+		{[]string{"**/foo"}, "foo", false, true},
+		{[]string{"**/foo"}, "a/b/foo", false, true},
+		{[]string{"**/foo/bar"}, "a/foo/bar", false, true},
+		{[]string{"abc/**"}, "abc", true, false},
+		{[]string{"abc/**"}, "abc/x", false, true},
+		{[]string{"abc/**"}, "abc/x/y", false, true},
+		{[]string{"a/**/b"}, "a/b", false, true},
+		{[]string{"a/**/b"}, "a/x/y/b", false, true},
+		{[]string{"a/**/b"}, "x/a/b", false, false},
+
+		// Character classes.
+		{[]string{"file[0-9]"}, "file5", false, true},
+		{[]string{"file[0-9]"}, "filex", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			var rules []ignoreRule
+			for _, p := range tt.patterns {
+				if r, ok := parseIgnoreRule(p); ok {
+					rules = append(rules, r)
+				}
+			}
+			if got := matchIgnoreRules(rules, tt.path, tt.isDir); got != tt.want {
+				t.Errorf("%q matching %q: got %v, want %v", tt.patterns, tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIgnorePatterns(t *testing.T) {
+	src := t.TempDir()
+	for _, p := range []string{
+		"a.log", "important.log", "a.txt",
+		"build/out", "sub/build/out", "sub/a.log", "sub/b.txt",
+		"doc/x.txt", "doc/y.md",
+	} {
+		p = filepath.Join(src, p)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		touch(t, p)
+	}
+
+	ignoreFile := filepath.Join(t.TempDir(), ".gitignore")
+	err := os.WriteFile(ignoreFile, []byte("# Logs\n*.log\n!important.log\n\n/build/\ndoc/*.txt\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// CopyTree() joins paths, so the root isn't always a prefix of the
+	// subdirectories as given.
+	t.Chdir(src)
+	for _, dir := range []string{src, src + "/", ".", "./", "../" + filepath.Base(src)} {
+		t.Run(dir, func(t *testing.T) {
+			ignore, err := IgnorePatternsFromFile(dir, ignoreFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			dst := filepath.Join(t.TempDir(), "dst")
+			if err := CopyTree(dir, dst, &CopyTreeOptions{Ignore: ignore}); err != nil {
+				t.Fatal(err)
+			}
+
+			got := listFiles(t, dst)
+			want := []string{"a.txt", "doc/y.md", "important.log", "sub/b.txt", "sub/build/out"}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("\nout:  %v\nwant: %v", got, want)
+			}
+		})
+	}
+
+	// The same function can be used for several copies, and the patterns stay
+	// relative to root when copying a subdirectory.
+	t.Run("reuse", func(t *testing.T) {
+		ignore := IgnorePatterns(src, "*.log", "/build/")
+		for _, tt := range []struct {
+			src  string
+			want []string
+		}{
+			{filepath.Join(src, "sub"), []string{"b.txt", "build/out"}},
+			{src, []string{"a.txt", "doc/x.txt", "doc/y.md", "sub/b.txt", "sub/build/out"}},
+		} {
+			dst := filepath.Join(t.TempDir(), "dst")
+			if err := CopyTree(tt.src, dst, &CopyTreeOptions{Ignore: ignore}); err != nil {
+				t.Fatal(err)
+			}
+			if got := listFiles(t, dst); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s\nout:  %v\nwant: %v", tt.src, got, tt.want)
+			}
+		}
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := IgnorePatternsFromFile(src, filepath.Join(src, "nonexistent"))
+		if !os.IsNotExist(errors.Cause(err)) {
+			t.Errorf("wrong error: %v", err)
+		}
+	})
+}
+
+func listFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	var files []string
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			rel, _ := filepath.Rel(dir, p)
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	return files
+}
@@ -0,0 +1,201 @@
+package sqlutil
+
+import (
+	"database/sql/driver"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/teamwork/utils/v2/aesutil"
+)
+
+type deterministicKeys struct {
+	siv, blindIndex string
+}
+
+var detKeys atomic.Pointer[deterministicKeys]
+
+// SetDeterministicKeys sets the keys for the DeterministicString and BlindIndex
+// types. This should be called once on startup, before using these types.
+//
+// The sivKey must be 32, 48, or 64 bytes; see aesutil.EncryptSIV. The
+// blindIndexKey can be of any length, but should be different from the sivKey.
+func SetDeterministicKeys(sivKey, blindIndexKey string) error {
+	if _, err := aesutil.EncryptSIV(sivKey, nil, nil); err != nil {
+		return err
+	}
+	if blindIndexKey == "" {
+		return errors.New("blind index key is empty")
+	}
+	detKeys.Store(&deterministicKeys{siv: sivKey, blindIndex: blindIndexKey})
+	return nil
+}
+
+func getDeterministicKeys() (*deterministicKeys, error) {
+	k := detKeys.Load()
+	if k == nil {
+		return nil, errors.New("sqlutil: SetDeterministicKeys not called")
+	}
+	return k, nil
+}
+
+// DeterministicString is a string which is stored encrypted with AES-SIV. The
+// same string always results in the same ciphertext, so the column can be used
+// in lookups:
+//
+//	db.Query(`select * from users where email=?`, sqlutil.DeterministicString(email))
+//
+// The keys must be set with SetDeterministicKeys.
+//
+// This is safe for NULL values, in which case it will scan in to an empty
+// string.
+type DeterministicString string
+
+// Value implements the SQL Value function to determine what to store in the DB.
+func (s DeterministicString) Value() (driver.Value, error) {
+	k, err := getDeterministicKeys()
+	if err != nil {
+		return nil, err
+	}
+	return aesutil.EncryptSIV(k.siv, []byte(s), nil)
+}
+
+// Scan converts the data returned from the DB into the struct.
+func (s *DeterministicString) Scan(v interface{}) error {
+	if v == nil {
+		*s = ""
+		return nil
+	}
+
+	k, err := getDeterministicKeys()
+	if err != nil {
+		return err
+	}
+	plain, err := aesutil.DecryptSIV(k.siv, fmt.Sprintf("%s", v), nil)
+	if err != nil {
+		return err
+	}
+	*s = DeterministicString(plain)
+	return nil
+}
+
+// BlindIndex is a string which is stored as a keyed hash, for equality lookups
+// on data that's stored with (non-deterministic) encryption in another column.
+//
+//	db.Exec(`insert into users (email, email_index) values (?, ?)`,
+//	    encryptedEmail, sqlutil.BlindIndex(email))
+//	db.Query(`select * from users where email_index=?`, sqlutil.BlindIndex(email))
+//
+// The keys must be set with SetDeterministicKeys.
+//
+// The hash can't be reversed, so Scan always returns an error; don't select
+// this column.
+type BlindIndex string
+
+// Value implements the SQL Value function to determine what to store in the DB.
+func (s BlindIndex) Value() (driver.Value, error) {
+	k, err := getDeterministicKeys()
+	if err != nil {
+		return nil, err
+	}
+	return aesutil.BlindIndex(k.blindIndex, []byte(s)), nil
+}
+
+// Scan always returns an error, as the hash can't be reversed.
+func (s *BlindIndex) Scan(v interface{}) error {
+	return errors.New("sqlutil: cannot scan in to BlindIndex")
+}
+
+type keyProvider struct{ aesutil.KeyProvider }
+
+var encKeys atomic.Pointer[keyProvider]
+
+// SetKeyProvider sets the key provider for the Encrypted type. This should be
+// called once on startup, before using this type.
+func SetKeyProvider(p aesutil.KeyProvider) {
+	encKeys.Store(&keyProvider{p})
+}
+
+func getKeyProvider() (aesutil.KeyProvider, error) {
+	p := encKeys.Load()
+	if p == nil || p.KeyProvider == nil {
+		return nil, errors.New("sqlutil: SetKeyProvider not called")
+	}
+	return p.KeyProvider, nil
+}
+
+// Encrypted is a value which is stored encrypted with the key provider set with
+// SetKeyProvider, for example an aesutil.Keyring.
+//
+// V is encoded with MarshalText if it implements encoding.TextMarshaler, stored
+// as-is if it's a string or []byte, and encoded as JSON otherwise. The
+// ciphertext is random, so the column can't be used in lookups; see
+// DeterministicString or BlindIndex for that.
+//
+// This is safe for NULL values, in which case it will scan in to the zero value
+// of T.
+type Encrypted[T any] struct {
+	V T
+}
+
+// Value implements the SQL Value function to determine what to store in the DB.
+func (e Encrypted[T]) Value() (driver.Value, error) {
+	p, err := getKeyProvider()
+	if err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	switch v := any(&e.V).(type) {
+	case encoding.TextMarshaler:
+		data, err = v.MarshalText()
+	case *string:
+		data = []byte(*v)
+	case *[]byte:
+		data = *v
+	default:
+		data, err = json.Marshal(e.V)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("sqlutil.Encrypted: %w", err)
+	}
+
+	return p.Encrypt(data, nil)
+}
+
+// Scan converts the data returned from the DB into the struct.
+func (e *Encrypted[T]) Scan(v interface{}) error {
+	var zero T
+	if v == nil {
+		e.V = zero
+		return nil
+	}
+
+	p, err := getKeyProvider()
+	if err != nil {
+		return err
+	}
+	data, err := p.Decrypt(fmt.Sprintf("%s", v), nil)
+	if err != nil {
+		return fmt.Errorf("sqlutil.Encrypted: %w", err)
+	}
+
+	val := zero
+	switch dst := any(&val).(type) {
+	case encoding.TextUnmarshaler:
+		err = dst.UnmarshalText(data)
+	case *string:
+		*dst = string(data)
+	case *[]byte:
+		*dst = data
+	default:
+		err = json.Unmarshal(data, dst)
+	}
+	if err != nil {
+		return fmt.Errorf("sqlutil.Encrypted: %w", err)
+	}
+	e.V = val
+	return nil
+}
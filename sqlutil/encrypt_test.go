@@ -0,0 +1,175 @@
+package sqlutil
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/teamwork/test"
+	"github.com/teamwork/utils/v2/aesutil"
+)
+
+const (
+	testSIVKey        = "0123456789abcdef0123456789abcdef"
+	testBlindIndexKey = "blind index key"
+)
+
+func TestSetDeterministicKeys(t *testing.T) {
+	cases := []struct {
+		siv, index, wantErr string
+	}{
+		{testSIVKey, testBlindIndexKey, ""},
+		{"short", testBlindIndexKey, "invalid AES-SIV key size 5"},
+		{testSIVKey, "", "blind index key is empty"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.wantErr, func(t *testing.T) {
+			err := SetDeterministicKeys(tc.siv, tc.index)
+			if !test.ErrorContains(err, tc.wantErr) {
+				t.Errorf("\nout:  %#v\nwant: %#v\n", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestDeterministicString(t *testing.T) {
+	detKeys.Store(nil)
+	if _, err := DeterministicString("x").Value(); !test.ErrorContains(err, "SetDeterministicKeys not called") {
+		t.Fatalf("wrong error: %v", err)
+	}
+
+	if err := SetDeterministicKeys(testSIVKey, testBlindIndexKey); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, in := range []DeterministicString{"", "jam@example.com"} {
+		t.Run(string(in), func(t *testing.T) {
+			v1, err := in.Value()
+			if err != nil {
+				t.Fatal(err)
+			}
+			v2, err := in.Value()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v1 != v2 {
+				t.Errorf("not deterministic:\n%v\n%v", v1, v2)
+			}
+
+			var out DeterministicString
+			if err := out.Scan([]byte(v1.(string))); err != nil {
+				t.Fatal(err)
+			}
+			if out != in {
+				t.Errorf("\nout:  %#v\nwant: %#v\n", out, in)
+			}
+		})
+	}
+
+	out := DeterministicString("x")
+	if err := out.Scan(nil); err != nil {
+		t.Fatal(err)
+	}
+	if out != "" {
+		t.Errorf("not empty after scanning NULL: %q", out)
+	}
+
+	if err := out.Scan("invalid"); err == nil {
+		t.Error("no error scanning invalid value")
+	}
+}
+
+func TestBlindIndex(t *testing.T) {
+	if err := SetDeterministicKeys(testSIVKey, testBlindIndexKey); err != nil {
+		t.Fatal(err)
+	}
+
+	v1, err := BlindIndex("jam@example.com").Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	v2, err := BlindIndex("jam@example.com").Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v1 != v2 {
+		t.Errorf("not deterministic:\n%v\n%v", v1, v2)
+	}
+	if v1 == "jam@example.com" {
+		t.Error("value not hashed")
+	}
+
+	var out BlindIndex
+	if err := out.Scan(v1); err == nil {
+		t.Error("no error from Scan")
+	}
+}
+
+func TestEncrypted(t *testing.T) {
+	encKeys.Store(nil)
+	if _, err := (Encrypted[string]{"x"}).Value(); !test.ErrorContains(err, "SetKeyProvider not called") {
+		t.Fatalf("wrong error: %v", err)
+	}
+
+	keyring, err := aesutil.NewKeyring("1", map[string]string{"1": "0123456789abcdef"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetKeyProvider(keyring)
+
+	type secret struct {
+		Token string
+		Scope []string
+	}
+
+	t.Run("string", func(t *testing.T) {
+		testEncrypted(t, Encrypted[string]{"hunter2"})
+	})
+	t.Run("bytes", func(t *testing.T) {
+		testEncrypted(t, Encrypted[[]byte]{[]byte{0, 1, 2}})
+	})
+	t.Run("text", func(t *testing.T) {
+		testEncrypted(t, Encrypted[time.Time]{time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)})
+	})
+	t.Run("json", func(t *testing.T) {
+		testEncrypted(t, Encrypted[secret]{secret{"abc", []string{"read", "write"}}})
+	})
+
+	t.Run("null", func(t *testing.T) {
+		out := Encrypted[string]{"x"}
+		if err := out.Scan(nil); err != nil {
+			t.Fatal(err)
+		}
+		if out.V != "" {
+			t.Errorf("not empty after scanning NULL: %q", out.V)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		var out Encrypted[string]
+		if err := out.Scan("invalid"); err == nil {
+			t.Error("no error scanning invalid value")
+		}
+	})
+}
+
+func testEncrypted[T any](t *testing.T, in Encrypted[T]) {
+	t.Helper()
+
+	v, err := in.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := v.(string); !ok {
+		t.Fatalf("Value returned %T", v)
+	}
+
+	var out Encrypted[T]
+	if err := out.Scan([]byte(v.(string))); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("\nout:  %#v\nwant: %#v\n", out, in)
+	}
+}